@@ -1,8 +1,11 @@
 package main
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"os/exec"
 	"strings"
 
@@ -20,51 +23,112 @@ type SSOCommand interface {
 // EKSCommand represents the commands for interacting with EKS
 type EKSCommand interface {
 	ListClusters(string, string) (string, error)
-	UpdateKubeConfig(string, string, string) (string, error)
+	DescribeCluster(string, string, string) (string, error)
+	UpdateKubeConfig(string, string, string, string) (string, error)
+}
+
+// STSCommand represents the commands for interacting with AWS STS
+type STSCommand interface {
+	AssumeRole(*Credential, string, []byte) (string, error)
 }
 
 // ----- SSO -----
 
 // SSOCli implements commands to perform SSO actions through AWS Cli
-type SSOCli struct{}
+type SSOCli struct {
+	Env []string
+}
 
 // Login retrieves  and  caches an AWS SSO access token to exchange for AWS credentials
-func (c *SSOCli) Login(roleName string) (string, error) {
-	return execCli("sso", "login", "--profile", roleName)
+func (c *SSOCli) Login(profile string) (string, error) {
+	return execCli(c.Env, "sso", "login", "--profile", profile)
 }
 
 // ListAccounts lists  all  AWS  accounts  assigned to the user
 func (c *SSOCli) ListAccounts(accessToken string, region string) (string, error) {
-	return execCli("sso", "list-accounts", "--access-token", accessToken, "--region", region)
+	return execCliToken(c.Env, accessToken, "sso", "list-accounts", "--region", region)
 }
 
 // ListAccountRoles lists  all roles that are assigned to the user for a given AWS account
 func (c *SSOCli) ListAccountRoles(accessToken string, region string, accountID string) (string, error) {
-	return execCli("sso", "list-account-roles", "--access-token", accessToken, "--region", region, "--account-id", accountID)
+	return execCliToken(c.Env, accessToken, "sso", "list-account-roles", "--region", region, "--account-id", accountID)
 }
 
 // GetRoleCredentials returns the STS short-term credentials for a given role name that is assigned to the user
 func (c *SSOCli) GetRoleCredentials(accessToken string, region string, accountID string, roleName string) (string, error) {
-	return execCli("sso", "get-role-credentials", "--access-token", accessToken, "--region", region, "--account-id", accountID, "--role-name", roleName)
+	return execCliToken(c.Env, accessToken, "sso", "get-role-credentials", "--region", region, "--account-id", accountID, "--role-name", roleName)
+}
+
+// ----- STS -----
+
+// STSCli implements commands to perform STS actions through AWS Cli
+type STSCli struct {
+	Env []string
+}
+
+// AssumeRole returns a set of temporary credentials of a role using the source credentials, which are
+// passed as environment variables. The request is passed through stdin as the --cli-input-json parameter.
+func (c *STSCli) AssumeRole(source *Credential, region string, input []byte) (string, error) {
+	env := append([]string{}, c.Env...)
+	env = append(env,
+		"AWS_ACCESS_KEY_ID="+source.AccessKeyID,
+		"AWS_SECRET_ACCESS_KEY="+source.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+source.SessionToken,
+	)
+
+	return execCliInput(env, input, "sts", "assume-role", "--region", region, "--cli-input-json", "file:///dev/stdin")
 }
 
 // ----- EKS -----
 
 // EKSCli implements commands to perform EKS actions through AWS Cli
-type EKSCli struct{}
+type EKSCli struct {
+	Env []string
+}
 
 // ListClusters lists the Amazon EKS clusters in your AWS account in the specified region
 func (k *EKSCli) ListClusters(region string, profile string) (string, error) {
-	return execCli("eks", "list-clusters", "--region", region, "--profile", profile)
+	return execCli(k.Env, "eks", "list-clusters", "--region", region, "--profile", profile)
+}
+
+// DescribeCluster returns descriptive information about an Amazon EKS cluster
+func (k *EKSCli) DescribeCluster(region string, profile string, name string) (string, error) {
+	return execCli(k.Env, "eks", "describe-cluster", "--name", name, "--region", region, "--profile", profile)
 }
 
 // UpdateKubeConfig configures kubectl so that you can connect to an Amazon EKS cluster
-func (k *EKSCli) UpdateKubeConfig(region string, profile string, name string) (string, error) {
-	return execCli("eks", "update-kubeconfig", "--name", name, "--region", region, "--profile", profile)
+func (k *EKSCli) UpdateKubeConfig(region string, profile string, name string, kubeconfig string) (string, error) {
+	return execCli(k.Env, "eks", "update-kubeconfig", "--name", name, "--region", region, "--profile", profile, "--kubeconfig", kubeconfig)
 }
 
-func execCli(args ...string) (string, error) {
-	cmd := exec.Command("aws", args...)
+// execCommand creates the aws cli process, it is replaced in tests
+var execCommand = exec.Command
+
+// execCliToken runs the aws cli passing the sso access token through stdin as the --cli-input-json
+// parameter, so it is not visible in the process arguments (ps, /proc/<pid>/cmdline)
+func execCliToken(env []string, accessToken string, args ...string) (string, error) {
+	input, err := json.Marshal(map[string]string{"accessToken": accessToken})
+	if err != nil {
+		return "", err
+	}
+
+	return execCliInput(env, input, append(args, "--cli-input-json", "file:///dev/stdin")...)
+}
+
+func execCli(env []string, args ...string) (string, error) {
+	return execCliInput(env, nil, args...)
+}
+
+func execCliInput(env []string, input []byte, args ...string) (string, error) {
+	cmd := execCommand("aws", args...)
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
+
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+
 	out, err := cmd.CombinedOutput()
 	outStr := strings.ReplaceAll(string(out), "\n", "")
 
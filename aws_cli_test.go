@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCliArgsWithoutSecrets(t *testing.T) {
+	var calls [][]string
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		calls = append(calls, append([]string{name}, args...))
+		// echoes the stdin to check the token has been sent through it
+		return exec.Command("sh", "-c", "cat")
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+
+	token := "aoaAAAAAGQsecret-sso-token"
+	sso := &SSOCli{}
+
+	for _, fn := range []func() (string, error){
+		func() (string, error) { return sso.ListAccounts(token, "us-east-1") },
+		func() (string, error) { return sso.ListAccountRoles(token, "us-east-1", "123456789012") },
+		func() (string, error) { return sso.GetRoleCredentials(token, "us-east-1", "123456789012", "ReadOnly") },
+	} {
+		out, err := fn()
+		require.Nil(t, err)
+		require.Equal(t, `{"accessToken":"`+token+`"}`, out)
+	}
+
+	require.Len(t, calls, 3)
+	for _, args := range calls {
+		cmdline := strings.Join(args, " ")
+		require.NotContains(t, cmdline, token)
+		require.NotContains(t, cmdline, "--access-token")
+		require.Contains(t, cmdline, "--cli-input-json file:///dev/stdin")
+	}
+}
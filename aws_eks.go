@@ -2,49 +2,232 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/mitchellh/go-homedir"
 	logger "github.com/rs/zerolog/log"
 )
 
-var kubeConfig string
+const (
+	// EKSSplitByAccount writes one kubeconfig file per account
+	EKSSplitByAccount = "account"
+	// EKSSplitByProfile writes one kubeconfig file per profile
+	EKSSplitByProfile = "profile"
+
+	kubeConfigPathsFile = "paths"
+	kubeConfigEnv       = "KUBECONFIG"
+)
+
+var (
+	kubeConfig    string
+	kubeConfigDir string
+
+	// the split kubeconfig files are named after account and profile names, which may hold any character
+	matchKubeConfigNameChars = regexp.MustCompile(`[^a-z0-9_.-]+`)
+)
 
 // EKSClusters defines the structure returned by AWS Cli
 type EKSClusters struct {
 	Items []string `json:"clusters"`
 }
 
+// EKSCluster defines the structure returned by AWS Cli
+type EKSCluster struct {
+	Item struct {
+		Name string            `json:"name"`
+		Tags map[string]string `json:"tags"`
+	} `json:"cluster"`
+}
+
+// EKSFilter defines the profiles and clusters considered by the EKS discovery,
+// all patterns use the shell file name pattern syntax
+type EKSFilter struct {
+	Include  []string          `json:"include,omitempty"`
+	Exclude  []string          `json:"exclude,omitempty"`
+	Profiles []string          `json:"profiles,omitempty"`
+	Roles    []string          `json:"roles,omitempty"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
 // EKS implements the flow to retrieve the EKS clusters configuration to use them with kubectl
 type EKS struct {
-	Cmd            EKSCommand
-	KubeConfigPath string
-	BackupFile     bool
+	Cmd             EKSCommand
+	KubeConfigPath  string
+	KubeConfigDir   string
+	KubeConfigPaths []string
+	SplitBy         string
+	Filter          *EKSFilter
+	BackupFile      bool
+	Backups         *BackupStore
+	Sandbox         *Sandbox
+	Report          *Report
+	owners          map[string]string
 }
 
 // NewEKS returns a new EKS
 func NewEKS(cmd EKSCommand, c *ConfigOptions) *EKS {
+	dir := kubeConfigDir
+	if c.KubeConfigDir != "" {
+		dir = c.KubeConfigDir
+	}
+
 	return &EKS{
 		Cmd:            cmd,
-		KubeConfigPath: kubeConfig,
+		KubeConfigPath: KubeConfigPath(c.KubeConfig),
+		KubeConfigDir:  dir,
+		SplitBy:        c.EKSSplit,
+		Filter:         c.EKS,
 		BackupFile:     c.BackupFile,
+		Backups:        NewBackupStore(c),
+	}
+}
+
+// KubeConfigPath returns the kubeconfig file to be written, the path provided by flag
+// takes precedence over the KUBECONFIG environment variable. As kubectl does, when the
+// variable contains a list of paths, the first one is chosen.
+func KubeConfigPath(path string) string {
+	if path != "" {
+		return path
+	}
+
+	for _, p := range filepath.SplitList(os.Getenv(kubeConfigEnv)) {
+		if p != "" {
+			return p
+		}
+	}
+
+	return kubeConfig
+}
+
+// AllowCredential returns if the clusters must be discovered using a given credential
+func (f *EKSFilter) AllowCredential(cred *Credential) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.Profiles) > 0 && !MatchAny(f.Profiles, cred.ProfileName) {
+		return false
+	}
+
+	return len(f.Roles) == 0 || MatchAny(f.Roles, cred.RoleName)
+}
+
+// AllowCluster returns if a cluster must be added to the kubeconfig
+func (f *EKSFilter) AllowCluster(name string) bool {
+	if f == nil {
+		return true
 	}
+
+	if len(f.Include) > 0 && !MatchAny(f.Include, name) {
+		return false
+	}
+
+	return !MatchAny(f.Exclude, name)
+}
+
+// HasTags returns if the clusters must be filtered by tags
+func (f *EKSFilter) HasTags() bool {
+	return f != nil && len(f.Tags) > 0
+}
+
+// AllowTags returns if the cluster tags contain all the filter tags,
+// the values of the filter tags can be patterns
+func (f *EKSFilter) AllowTags(tags map[string]string) bool {
+	if !f.HasTags() {
+		return true
+	}
+
+	for k, p := range f.Tags {
+		v, ok := tags[k]
+		if !ok || !MatchAny([]string{p}, v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Split returns if the kubeconfig must be written in one file per account or profile
+func (e *EKS) Split() bool {
+	return e.SplitBy != ""
+}
+
+// KubeConfigFor returns the kubeconfig file used to store the clusters of a given credential,
+// two accounts or profiles whose names result in the same file are refused
+func (e *EKS) KubeConfigFor(cred *Credential) (string, error) {
+	var name, owner string
+	switch e.SplitBy {
+	case "":
+		return e.KubeConfigPath, nil
+	case EKSSplitByAccount:
+		// the chained profiles of accounts not assigned to the user have no account name
+		name = cred.AccountName
+		if name == "" {
+			name = cred.AccountID
+		}
+		owner = fmt.Sprintf("%s (%s)", name, cred.AccountID)
+	case EKSSplitByProfile:
+		name, owner = cred.ProfileName, cred.ProfileName
+	default:
+		return "", fmt.Errorf("invalid eks split mode %q, use [%s|%s]", e.SplitBy, EKSSplitByAccount, EKSSplitByProfile)
+	}
+
+	file, err := kubeConfigName(name)
+	if err != nil {
+		return "", err
+	}
+
+	if e.owners == nil {
+		e.owners = map[string]string{}
+	}
+	if o, ok := e.owners[file]; ok && o != owner {
+		return "", fmt.Errorf("the %s %q and %q are both written to the kubeconfig %s, please rename one of them or use another --eks-split mode", e.SplitBy, o, owner, file)
+	}
+	e.owners[file] = owner
+
+	return filepath.Join(e.KubeConfigDir, file), nil
+}
+
+// kubeConfigName returns a file name that stays in the kubeconfig directory, the characters
+// other than [a-z0-9_.-] are replaced by "-" and the leading and trailing dots are removed
+func kubeConfigName(name string) (string, error) {
+	file := strings.Trim(matchKubeConfigNameChars.ReplaceAllString(strings.ToLower(name), "-"), ".-")
+
+	if file == "" {
+		return "", fmt.Errorf("the name %q can not be used as a kubeconfig file name", name)
+	}
+
+	if file == kubeConfigPathsFile {
+		return "", fmt.Errorf("the name %q is reserved for the kubeconfig path list, please use another --eks-split mode", name)
+	}
+
+	return file, nil
+}
+
+// PathsFile returns the file that contains the generated KUBECONFIG path list
+func (e *EKS) PathsFile() string {
+	return filepath.Join(e.KubeConfigDir, kubeConfigPathsFile)
 }
 
 // UpdateKubeConfig constructs a configuration with prepopulated server and certificate
 // authority data values for each credential retrieved.
 func (e *EKS) UpdateKubeConfig(creds []*Credential) error {
-	if e.BackupFile {
-		kubeConfigFile := NewFile(e.KubeConfigPath)
-		filename, err := kubeConfigFile.Backup()
-		if err != nil {
+	if !e.Split() {
+		if err := e.backup(e.KubeConfigPath); err != nil {
 			return err
 		}
-
-		logger.Info().Str("path", filename).Msg("backup completed successfully")
 	}
 
 	for _, cred := range creds {
+		if !e.Filter.AllowCredential(cred) {
+			logger.Debug().Str("profile", cred.ProfileName).Str("role", cred.RoleName).Msg("skipping eks clusters discovery")
+			continue
+		}
+
 		out, err := e.Cmd.ListClusters(cred.Region, cred.ProfileName)
 		if err != nil {
 			return err
@@ -60,17 +243,159 @@ func (e *EKS) UpdateKubeConfig(creds []*Credential) error {
 
 		logger.Debug().Msgf("%d clusters were found", len(clusters.Items))
 
-		for _, c := range clusters.Items {
-			out, err := e.Cmd.UpdateKubeConfig(cred.Region, cred.ProfileName, c)
-			if err != nil {
+		clusters.Items, err = e.filter(cred, clusters.Items)
+		if err != nil {
+			return err
+		}
+
+		if len(clusters.Items) == 0 {
+			continue
+		}
+
+		path, err := e.KubeConfigFor(cred)
+		if err != nil {
+			return err
+		}
+
+		if e.Split() && !e.touched(path) {
+			if err := e.backup(path); err != nil {
 				return err
 			}
+		}
+
+		target, err := e.Sandbox.Path(path)
+		if err != nil {
+			return err
+		}
+		e.Report.AddFile(path)
+
+		if err := e.update(cred, clusters.Items, path, target); err != nil {
+			return err
+		}
+
+		if !e.touched(path) {
+			e.KubeConfigPaths = append(e.KubeConfigPaths, path)
+		}
+	}
+
+	if e.Split() {
+		return e.writePaths()
+	}
+
+	return nil
+}
+
+// filter removes the clusters that do not match the filter patterns and tags
+func (e *EKS) filter(cred *Credential, names []string) ([]string, error) {
+	var allowed []string
+	for _, name := range names {
+		if !e.Filter.AllowCluster(name) {
+			logger.Debug().Str("cluster", name).Msg("skipping eks cluster by name")
+			continue
+		}
+
+		if e.Filter.HasTags() {
+			out, err := e.Cmd.DescribeCluster(cred.Region, cred.ProfileName, name)
+			if err != nil {
+				return nil, err
+			}
+
+			cluster := &EKSCluster{}
+			if err := json.Unmarshal([]byte(out), cluster); err != nil {
+				return nil, err
+			}
+
+			if !e.Filter.AllowTags(cluster.Item.Tags) {
+				logger.Debug().Str("cluster", name).Interface("tags", cluster.Item.Tags).Msg("skipping eks cluster by tags")
+				continue
+			}
+		}
+
+		allowed = append(allowed, name)
+	}
+
+	return allowed, nil
+}
 
-			logger.Info().Str("cluster", c).Str("profile", cred.ProfileName).Msg("kubeconfig successfully updated")
+// update adds the clusters to the kubeconfig holding its lock, so concurrent
+// asl processes do not interleave their writes, path is the sandbox copy of the kubeconfig in a dry run
+func (e *EKS) update(cred *Credential, clusters []string, kubeconfig string, path string) error {
+	unlock, err := NewFile(path).Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
 
-			logger.Trace().Str("cluster", c).Msg(out)
+	// the kubeconfig is written by the aws cli, it may hold client keys and tokens
+	if err := permissions.Audit(path, true, true); err != nil {
+		return err
+	}
+
+	for _, c := range clusters {
+		out, err := e.Cmd.UpdateKubeConfig(cred.Region, cred.ProfileName, c, path)
+		if err != nil {
+			return err
 		}
+
+		logger.Info().Str("cluster", c).Str("profile", cred.ProfileName).Str("path", path).Msg("kubeconfig successfully updated")
+
+		logger.Trace().Str("cluster", c).Msg(out)
+
+		e.Report.AddContext(cred, c, kubeconfig, out)
+	}
+
+	return nil
+}
+
+func (e *EKS) backup(path string) error {
+	if !e.BackupFile || e.Sandbox != nil {
+		return nil
+	}
+
+	f := NewFile(path)
+	f.Secret = true
+
+	b, err := e.Backups.Save(f)
+	if err != nil {
+		return err
 	}
+	e.Report.AddBackup(b)
+
+	if b != nil {
+		logger.Info().Str("id", b.ID).Str("path", b.Source).Msg("backup completed successfully")
+	}
+
+	return nil
+}
+
+func (e *EKS) touched(path string) bool {
+	for _, p := range e.KubeConfigPaths {
+		if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// writePaths stores the KUBECONFIG path list with all generated kubeconfig files
+func (e *EKS) writePaths() error {
+	target, err := e.Sandbox.Path(e.PathsFile())
+	if err != nil {
+		return err
+	}
+	e.Report.AddFile(e.PathsFile())
+
+	f := NewFile(target)
+	if err := f.Create(); err != nil {
+		return err
+	}
+
+	paths := strings.Join(e.KubeConfigPaths, string(os.PathListSeparator))
+	if err := f.Write(paths + "\n"); err != nil {
+		return err
+	}
+
+	logger.Debug().Str("path", f.FullName).Int("files", len(e.KubeConfigPaths)).Msg("the kubeconfig path list has been stored")
 
 	return nil
 }
@@ -82,4 +407,5 @@ func init() {
 	}
 
 	kubeConfig = filepath.Join(home, ".kube", "config")
+	kubeConfigDir = filepath.Join(home, ".kube", "asl")
 }
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type EKSMock struct {
+	Clusters map[string]string
+	Tags     map[string]string
+	Updated  map[string][]string
+}
+
+func (k *EKSMock) ListClusters(region string, profile string) (string, error) {
+	return k.Clusters[profile], nil
+}
+
+func (k *EKSMock) DescribeCluster(region string, profile string, name string) (string, error) {
+	return fmt.Sprintf(`{"cluster": {"name": "%s", "tags": %s}}`, name, k.Tags[name]), nil
+}
+
+func (k *EKSMock) UpdateKubeConfig(region string, profile string, name string, kubeconfig string) (string, error) {
+	if k.Updated == nil {
+		k.Updated = map[string][]string{}
+	}
+	k.Updated[kubeconfig] = append(k.Updated[kubeconfig], name)
+	return "", nil
+}
+
+func TestKubeConfigForSplitMode(t *testing.T) {
+	cred := &Credential{AccountName: "My Account", ProfileName: "my-account-admin"}
+
+	e := &EKS{KubeConfigPath: "/tmp/kube/config", KubeConfigDir: "/tmp/kube/asl"}
+	p, err := e.KubeConfigFor(cred)
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/kube/config", p)
+
+	e.SplitBy = EKSSplitByAccount
+	p, _ = e.KubeConfigFor(cred)
+	require.Equal(t, "/tmp/kube/asl/my-account", p)
+
+	e.SplitBy = EKSSplitByProfile
+	p, _ = e.KubeConfigFor(cred)
+	require.Equal(t, "/tmp/kube/asl/my-account-admin", p)
+
+	e.SplitBy = "foo"
+	_, err = e.KubeConfigFor(cred)
+	require.NotNil(t, err)
+}
+
+func TestKubeConfigForSanitizesNames(t *testing.T) {
+	e := &EKS{KubeConfigDir: "/tmp/kube/asl", SplitBy: EKSSplitByAccount}
+
+	p, err := e.KubeConfigFor(&Credential{AccountID: "1", AccountName: "../../etc/Passwd"})
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/kube/asl/etc-passwd", p)
+
+	p, err = e.KubeConfigFor(&Credential{AccountID: "2", AccountName: "Dev (EU) / Ops"})
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/kube/asl/dev-eu-ops", p)
+
+	_, err = e.KubeConfigFor(&Credential{AccountID: "2", AccountName: "Dev (EU) / Ops"})
+	require.Nil(t, err)
+
+	_, err = e.KubeConfigFor(&Credential{AccountID: "3", AccountName: "dev-eu-ops"})
+	require.EqualError(t, err, `the account "Dev (EU) / Ops (2)" and "dev-eu-ops (3)" are both written to the kubeconfig dev-eu-ops, please rename one of them or use another --eks-split mode`)
+
+	_, err = e.KubeConfigFor(&Credential{AccountID: "4", AccountName: "Paths"})
+	require.NotNil(t, err)
+
+	_, err = e.KubeConfigFor(&Credential{AccountID: "5", AccountName: ".."})
+	require.NotNil(t, err)
+}
+
+func TestNewEKSKubeConfigDir(t *testing.T) {
+	require.Equal(t, kubeConfigDir, NewEKS(&EKSMock{}, &ConfigOptions{}).KubeConfigDir)
+	require.Equal(t, "/tmp/kube/split", NewEKS(&EKSMock{}, &ConfigOptions{KubeConfigDir: "/tmp/kube/split"}).KubeConfigDir)
+}
+
+func TestUpdateKubeConfigSplitByAccount(t *testing.T) {
+	dir := t.TempDir()
+	cmd := &EKSMock{Clusters: map[string]string{
+		"dev":       `{"clusters": ["dev-1", "dev-2"]}`,
+		"dev-admin": `{"clusters": ["dev-3"]}`,
+		"prod":      `{"clusters": []}`,
+	}}
+
+	e := &EKS{Cmd: cmd, KubeConfigDir: dir, SplitBy: EKSSplitByAccount}
+	err := e.UpdateKubeConfig([]*Credential{
+		{AccountName: "Dev", ProfileName: "dev"},
+		{AccountName: "Dev", ProfileName: "dev-admin"},
+		{AccountName: "Prod", ProfileName: "prod"},
+	})
+	require.Nil(t, err)
+
+	devPath := filepath.Join(dir, "dev")
+	require.Equal(t, []string{devPath}, e.KubeConfigPaths)
+	require.Equal(t, []string{"dev-1", "dev-2", "dev-3"}, cmd.Updated[devPath])
+
+	paths, _ := NewFile(e.PathsFile()).ReadString()
+	require.Equal(t, devPath+"\n", paths)
+}
+
+func TestUpdateKubeConfigSplitByAccountChained(t *testing.T) {
+	dir := t.TempDir()
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{ChainedProfiles: []*ChainedProfile{
+		{Name: "shared-deploy", SourceAccount: "Dev", SourceRole: "ReadOnly", RoleARN: "arn:aws:iam::210987654321:role/Deploy"},
+		{Name: "external-deploy", SourceAccount: "Dev", SourceRole: "ReadOnly", RoleARN: "arn:aws:iam::999999999999:role/Deploy"},
+	}})
+	sso.STS = &STSMock{}
+
+	creds := []*Credential{
+		{AccountID: "123456789012", AccountName: "Dev", RoleName: "ReadOnly", ProfileName: "dev"},
+		{AccountID: "210987654321", AccountName: "Shared", RoleName: "ReadOnly", ProfileName: "shared"},
+	}
+	chained, err := sso.AssumeRoles(creds)
+	require.Nil(t, err)
+	require.Equal(t, "Shared", chained[0].AccountName)
+	require.Equal(t, "", chained[1].AccountName)
+
+	cmd := &EKSMock{Clusters: map[string]string{
+		"dev":             `{"clusters": []}`,
+		"shared":          `{"clusters": []}`,
+		"shared-deploy":   `{"clusters": ["shared-1"]}`,
+		"external-deploy": `{"clusters": ["external-1"]}`,
+	}}
+
+	e := &EKS{Cmd: cmd, KubeConfigDir: dir, SplitBy: EKSSplitByAccount}
+	require.Nil(t, e.UpdateKubeConfig(append(creds, chained...)))
+
+	require.Equal(t, []string{"shared-1"}, cmd.Updated[filepath.Join(dir, "shared")])
+	require.Equal(t, []string{"external-1"}, cmd.Updated[filepath.Join(dir, "999999999999")])
+}
+
+func TestUpdateKubeConfigWithFilters(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	cmd := &EKSMock{
+		Clusters: map[string]string{
+			"dev":      `{"clusters": ["dev-1", "dev-2", "sandbox-1", "dev-legacy"]}`,
+			"dev-read": `{"clusters": ["dev-1"]}`,
+		},
+		Tags: map[string]string{
+			"dev-1":      `{"team": "platform"}`,
+			"dev-2":      `{"team": "data"}`,
+			"dev-legacy": `{"team": "platform"}`,
+		},
+	}
+
+	e := &EKS{
+		Cmd:            cmd,
+		KubeConfigPath: kubeconfig,
+		Filter: &EKSFilter{
+			Include: []string{"dev-*"},
+			Exclude: []string{"*-legacy"},
+			Roles:   []string{"Admin*"},
+			Tags:    map[string]string{"team": "plat*"},
+		},
+	}
+	err := e.UpdateKubeConfig([]*Credential{
+		{ProfileName: "dev", RoleName: "AdministratorAccess"},
+		{ProfileName: "dev-read", RoleName: "ReadOnly"},
+	})
+	require.Nil(t, err)
+	require.Equal(t, map[string][]string{kubeconfig: {"dev-1"}}, cmd.Updated)
+}
+
+func TestKubeConfigPath(t *testing.T) {
+	t.Setenv(kubeConfigEnv, "")
+	require.Equal(t, kubeConfig, KubeConfigPath(""))
+
+	t.Setenv(kubeConfigEnv, "/tmp/kube/a"+string(os.PathListSeparator)+"/tmp/kube/b")
+	require.Equal(t, "/tmp/kube/a", KubeConfigPath(""))
+
+	t.Setenv(kubeConfigEnv, string(os.PathListSeparator)+"/tmp/kube/b")
+	require.Equal(t, "/tmp/kube/b", KubeConfigPath(""))
+
+	require.Equal(t, "/tmp/kube/flag", KubeConfigPath("/tmp/kube/flag"))
+}
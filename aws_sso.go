@@ -8,12 +8,12 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/mitchellh/go-homedir"
 	logger "github.com/rs/zerolog/log"
-	"gopkg.in/ini.v1"
 )
 
 const (
@@ -23,13 +23,42 @@ const (
 	keySSORegion          = "sso_region"
 	keySSOAccountID       = "sso_account_id"
 	keySSORoleName        = "sso_role_name"
+	keySSOSession         = "sso_session"
+	keySSOScopes          = "sso_registration_scopes"
 	keyCrdAccessKeyID     = "aws_access_key_id"
 	keyCrdSecretAccessKey = "aws_secret_access_key"
 	keyCrdSessionToken    = "aws_session_token"
+	keyCredentialProcess  = "credential_process"
+	keyRoleARN            = "role_arn"
+	keySourceProfile      = "source_profile"
+	keyExternalID         = "external_id"
+	keyRoleSessionName    = "role_session_name"
+	keyDurationSeconds    = "duration_seconds"
+	keyMFASerial          = "mfa_serial"
+	keyExpiration         = "aws_expiration"
+
+	// DefaultBootstrapProfile is the profile used to log in to AWS SSO
+	DefaultBootstrapProfile = "asl-bootstrap"
+	// DefaultSSOSession is the sso-session referenced by the generated sso profiles
+	DefaultSSOSession = "asl"
+	ssoScopes         = "sso:account:access"
+	managedComment    = "# managed by asl, changes will be overwritten"
+)
+
+const (
+	awsConfigFileEnv      = "AWS_CONFIG_FILE"
+	awsCredentialsFileEnv = "AWS_SHARED_CREDENTIALS_FILE"
 )
 
 var awsPath string
 
+// AWSFiles defines the location of the files shared with the aws cli
+type AWSFiles struct {
+	Config      string
+	Credentials string
+	SSOCache    string
+}
+
 // SSOCredential defines the structure returned by AWS Cli
 type SSOCredential struct {
 	URL          string `json:"startUrl"`
@@ -40,13 +69,26 @@ type SSOCredential struct {
 
 // SSO implements the flow to retrieve the AWS SSO credentials
 type SSO struct {
-	Cmd           SSOCommand `json:"-"`
-	AccountID     string     `json:"accountId"`
-	RoleName      string     `json:"roleName"`
-	StartURL      string     `json:"startUrl"`
-	Region        string     `json:"region"`
-	BackupFile    bool       `json:"-"`
-	ForceSSOLogin bool       `json:"-"`
+	Cmd           SSOCommand                          `json:"-"`
+	AccountID     string                              `json:"accountId"`
+	RoleName      string                              `json:"roleName"`
+	StartURL      string                              `json:"startUrl"`
+	Region        string                              `json:"region"`
+	Bootstrap     string                              `json:"bootstrapProfile"`
+	SSOProfiles   bool                                `json:"ssoProfiles"`
+	Session       string                              `json:"ssoSession"`
+	Profile       *ProfileOptions                     `json:"-"`
+	Files         *AWSFiles                           `json:"-"`
+	BackupFile    bool                                `json:"-"`
+	ForceSSOLogin bool                                `json:"-"`
+	Backups       *BackupStore                        `json:"-"`
+	Sandbox       *Sandbox                            `json:"-"`
+	SecretStore   string                              `json:"secretStore"`
+	Secrets       SecretStore                         `json:"-"`
+	Chained       []*ChainedProfile                   `json:"chainedProfiles"`
+	STS           STSCommand                          `json:"-"`
+	MFAToken      func(serial string) (string, error) `json:"-"`
+	Report        *Report                             `json:"-"`
 }
 
 // Accounts defines the structure returned by AWS Cli
@@ -80,32 +122,94 @@ type Credentials struct {
 
 // Credential defines the structure returned by AWS Cli
 type Credential struct {
-	ProfileName     string `json:"-"`
-	AccountName     string `json:"-"`
-	Region          string `json:"-"`
-	AccessKeyID     string `json:"accessKeyId"`
-	SecretAccessKey string `json:"secretAccessKey"`
-	SessionToken    string `json:"sessionToken"`
-	Expiration      int64  `json:"expiration"`
+	ProfileName     string            `json:"-"`
+	AccountID       string            `json:"-"`
+	AccountName     string            `json:"-"`
+	RoleName        string            `json:"-"`
+	Region          string            `json:"-"`
+	Keys            map[string]string `json:"-"`
+	AccessKeyID     string            `json:"accessKeyId"`
+	SecretAccessKey string            `json:"secretAccessKey"`
+	SessionToken    string            `json:"sessionToken"`
+	Expiration      int64             `json:"expiration"`
 }
 
-// CredentialResultInfo defines the information about SSO credentials
+// CredentialResultInfo defines the information about SSO credentials,
+// ExpiresAt is the earliest expiration and Expirations holds the expiration of each profile
 type CredentialResultInfo struct {
-	Filename  string
-	ExpiresAt time.Time
+	Filename    string
+	ExpiresAt   time.Time
+	Expirations map[string]time.Time
 }
 
 // NewSSO returns a new SSO
 func NewSSO(cmd SSOCommand, c *ConfigOptions) *SSO {
 	return &SSO{
-		cmd,
-		c.AccountID,
-		c.RoleName,
-		c.StartURL,
-		c.Region,
-		c.BackupFile,
-		c.ForceSSOLogin,
+		Cmd:           cmd,
+		AccountID:     c.AccountID,
+		RoleName:      c.RoleName,
+		StartURL:      c.StartURL,
+		Region:        c.Region,
+		Bootstrap:     c.BootstrapProfileName(),
+		SSOProfiles:   c.SSOProfiles,
+		Session:       c.SSOSessionName(),
+		Profile:       c.Profiles,
+		Files:         NewAWSFiles(c),
+		BackupFile:    c.BackupFile,
+		ForceSSOLogin: c.ForceSSOLogin,
+		Backups:       NewBackupStore(c),
+		SecretStore:   c.SecretStore,
+		Chained:       c.ChainedProfiles,
+	}
+}
+
+// NewAWSFiles returns the location of the aws files, the flags take precedence over the
+// AWS_CONFIG_FILE and AWS_SHARED_CREDENTIALS_FILE environment variables honored by the aws cli
+func NewAWSFiles(c *ConfigOptions) *AWSFiles {
+	f := &AWSFiles{
+		Config:      filepath.Join(awsPath, "config"),
+		Credentials: filepath.Join(awsPath, "credentials"),
+		SSOCache:    filepath.Join(awsPath, awsSSOPath, "cache"),
+	}
+
+	if v := os.Getenv(awsConfigFileEnv); v != "" {
+		f.Config = v
+	}
+	if v := os.Getenv(awsCredentialsFileEnv); v != "" {
+		f.Credentials = v
+	}
+
+	if c.AWSConfigFile != "" {
+		f.Config = c.AWSConfigFile
+	}
+	if c.AWSCredentialsFile != "" {
+		f.Credentials = c.AWSCredentialsFile
+	}
+	// the aws cli can not move its sso cache, the directory is only where asl reads the token
+	if c.SSOCacheDir != "" {
+		f.SSOCache = c.SSOCacheDir
 	}
+
+	return f
+}
+
+// CliEnv returns the environment variables used to point the aws cli to the
+// files written by asl, in dry-run mode they are the sandbox copies
+func (f *AWSFiles) CliEnv(s *Sandbox) ([]string, error) {
+	config, err := s.Path(f.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	cred, err := s.Path(f.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{
+		awsConfigFileEnv + "=" + config,
+		awsCredentialsFileEnv + "=" + cred,
+	}, nil
 }
 
 // List returns a slice of account roles
@@ -147,9 +251,57 @@ func (d *Credential) ExpiresAt() time.Time {
 	return time.Unix(d.Expiration/1000, 0)
 }
 
+// Summary describes when the credentials expire, the earliest and the latest expirations are shown
+// when the profiles have different session durations and the ones that expire within short are highlighted
+func (r *CredentialResultInfo) Summary(short time.Duration) string {
+	if len(r.Expirations) == 0 {
+		return fmt.Sprintf("note that it will expire at %s", formatExpiration(r.ExpiresAt))
+	}
+
+	var names []string
+	for p := range r.Expirations {
+		names = append(names, p)
+	}
+	sort.Strings(names)
+
+	first, last := names[0], names[0]
+	var shortLived []string
+	for _, p := range names {
+		exp := r.Expirations[p]
+		if exp.Before(r.Expirations[first]) {
+			first = p
+		}
+		if exp.After(r.Expirations[last]) {
+			last = p
+		}
+		if time.Until(exp) < short {
+			shortLived = append(shortLived, p)
+		}
+	}
+
+	summary := fmt.Sprintf("note that they will expire at %s", formatExpiration(r.Expirations[first]))
+	if !r.Expirations[first].Equal(r.Expirations[last]) {
+		summary = fmt.Sprintf("note that they will expire between %s (%s) and %s (%s)",
+			formatExpiration(r.Expirations[first]), first, formatExpiration(r.Expirations[last]), last)
+	}
+
+	if len(shortLived) > 0 {
+		summary += fmt.Sprintf("\nwarning: the credentials of %s expire in less than %s", strings.Join(shortLived, ", "), short)
+	}
+
+	return summary
+}
+
+func formatExpiration(t time.Time) string {
+	return t.Local().Format("2006-01-02 15:04:05 MST")
+}
+
 // PersistConfig writes the sso config file
 func (a *SSO) PersistConfig() error {
-	config := NewFile(awsPath, "config")
+	config, err := a.file(a.Files.Config)
+	if err != nil {
+		return err
+	}
 
 	logger.Debug().Str("path", config.FullName).Msg("preparing to store the aws sso config file")
 
@@ -158,26 +310,56 @@ func (a *SSO) PersistConfig() error {
 		return err
 	}
 
-	if a.BackupFile {
-		filename, err := config.Backup()
-		if err != nil {
-			return err
+	if err := a.backup(config); err != nil {
+		return err
+	}
+
+	err = config.Update(func(b []byte) ([]byte, error) {
+		cfg := ParseIni(b)
+
+		s := profileSection(a.Bootstrap)
+		if cfg.HasSection(s) && !managed(cfg, s) {
+			return nil, fmt.Errorf("the profile %s already exists in %s and it is not managed by asl, please choose another bootstrap profile name: asl configure --bootstrap-profile <name>", a.Bootstrap, config.FullName)
 		}
 
-		logger.Info().Str("path", filename).Msg("backup completed successfully")
-	}
+		a.removeLegacyProfile(cfg)
+
+		cfg.AddSection(s, managedComment)
+		cfg.Set(s, "output", "json")
+		cfg.Set(s, keyRegion, a.Region)
 
-	cfg, _ := ini.LooseLoad(config.FullName)
+		if a.SSOProfiles {
+			ss := ssoSessionSection(a.Session)
+			if cfg.HasSection(ss) && !managed(cfg, ss) {
+				return nil, fmt.Errorf("the sso-session %s already exists in %s and it is not managed by asl, please choose another name: asl configure --sso-session <name>", a.Session, config.FullName)
+			}
 
-	s := cfg.Section(fmt.Sprintf("profile %s", a.RoleName))
-	s.Key("output").SetValue("json")
-	s.Key(keyRegion).SetValue(a.Region)
-	s.Key(keySSOUrl).SetValue(a.StartURL)
-	s.Key(keySSORegion).SetValue(a.Region)
-	s.Key(keySSOAccountID).SetValue(a.AccountID)
-	s.Key(keySSORoleName).SetValue(a.RoleName)
+			cfg.AddSection(ss, managedComment)
+			cfg.Set(ss, keySSOUrl, a.StartURL)
+			cfg.Set(ss, keySSORegion, a.Region)
+			cfg.Set(ss, keySSOScopes, ssoScopes)
+
+			cfg.DeleteKey(s, keySSOUrl)
+			cfg.DeleteKey(s, keySSORegion)
+			cfg.Set(s, keySSOSession, a.Session)
+		} else {
+			cfg.DeleteKey(s, keySSOSession)
+			cfg.Set(s, keySSOUrl, a.StartURL)
+			cfg.Set(s, keySSORegion, a.Region)
+		}
 
-	if err := cfg.SaveTo(config.FullName); err != nil {
+		// the account and role are unknown while asl configure looks for them
+		if a.AccountID != "" && a.RoleName != "" {
+			cfg.Set(s, keySSOAccountID, a.AccountID)
+			cfg.Set(s, keySSORoleName, a.RoleName)
+		} else {
+			cfg.DeleteKey(s, keySSOAccountID)
+			cfg.DeleteKey(s, keySSORoleName)
+		}
+
+		return cfg.Bytes(), nil
+	})
+	if err != nil {
 		return err
 	}
 
@@ -186,6 +368,88 @@ func (a *SSO) PersistConfig() error {
 	return nil
 }
 
+// file returns the file to be written, it is redirected to the sandbox in dry-run mode
+func (a *SSO) file(path ...string) (*File, error) {
+	p, err := a.Sandbox.Path(filepath.Join(path...))
+	if err != nil {
+		return nil, err
+	}
+	a.Report.AddFile(filepath.Join(path...))
+
+	return NewFile(p), nil
+}
+
+func (a *SSO) backup(f *File) error {
+	if !a.BackupFile || a.Sandbox != nil {
+		return nil
+	}
+
+	b, err := a.Backups.Save(f)
+	if err != nil {
+		return err
+	}
+	a.Report.AddBackup(b)
+
+	if b != nil {
+		logger.Info().Str("id", b.ID).Str("path", b.Source).Msg("backup completed successfully")
+	}
+
+	return nil
+}
+
+// removeLegacyProfile removes the profile named after the role that older asl versions
+// used to log in, it is only removed when its content was entirely written by asl
+func (a *SSO) removeLegacyProfile(cfg *IniFile) {
+	s := profileSection(a.RoleName)
+	if a.RoleName == a.Bootstrap || !cfg.HasSection(s) {
+		return
+	}
+
+	legacy := map[string]string{
+		"output":        "json",
+		keyRegion:       a.Region,
+		keySSOUrl:       a.StartURL,
+		keySSORegion:    a.Region,
+		keySSOAccountID: a.AccountID,
+		keySSORoleName:  a.RoleName,
+	}
+
+	keys := cfg.Keys(s)
+	if len(keys) != len(legacy) {
+		return
+	}
+
+	for _, k := range keys {
+		if v, _ := cfg.Get(s, k); v != legacy[k] {
+			return
+		}
+	}
+
+	cfg.DeleteSection(s)
+
+	logger.Info().Str("profile", a.RoleName).Msgf("the legacy bootstrap profile has been replaced by the profile %s", a.Bootstrap)
+}
+
+// profileSection returns the section name of a profile in the aws config file
+func profileSection(name string) string {
+	return fmt.Sprintf("profile %s", name)
+}
+
+// ssoSessionSection returns the section name of a sso-session in the aws config file
+func ssoSessionSection(name string) string {
+	return fmt.Sprintf("sso-session %s", name)
+}
+
+// managed returns if the section has been created by asl
+func managed(cfg *IniFile, section string) bool {
+	for _, c := range cfg.Comments(section) {
+		if c == managedComment {
+			return true
+		}
+	}
+	return false
+}
+
 func (a *SSO) loginRetry(v []bool) bool {
 	return len(v) > 0 && v[0]
 }
@@ -194,7 +458,7 @@ func (a *SSO) loginRetry(v []bool) bool {
 // when cache credential has expired forces a login
 func (a *SSO) Login(retry ...bool) (*SSOCredential, error) {
 	if a.ForceSSOLogin || a.loginRetry(retry) {
-		_, err := a.Cmd.Login(a.RoleName)
+		_, err := a.Cmd.Login(a.Bootstrap)
 		if err != nil {
 			return nil, err
 		}
@@ -256,36 +520,58 @@ func (a *SSO) ListAccounts(c *SSOCredential) ([]*Account, error) {
 	return accounts.Items, nil
 }
 
-// GetCredentials retrieves the credentials of the account assigned to the user
-func (a *SSO) GetCredentials(c *SSOCredential, accounts []*Account) ([]*Credential, error) {
-	var creds []*Credential
+// Profiles returns a profile for each role of the accounts assigned to the user,
+// the first role of an account is named after the account and the others are suffixed by the role name
+func (a *SSO) Profiles(c *SSOCredential, accounts []*Account) []*Credential {
+	var profiles []*Credential
 	for _, acc := range accounts {
 		for i, r := range acc.Roles {
-			out, err := a.Cmd.GetRoleCredentials(c.AccessToken, c.Region, acc.ID, r)
-			if err != nil {
-				return nil, err
-			}
-
-			cs := &Credentials{}
-			if err := json.Unmarshal([]byte(out), cs); err != nil {
-				return nil, err
-			}
-
-			logger.Debug().Interface("credentials", cs).Str("accountID", acc.ID).Str("role", r).Msg("credentials...")
-
 			profile := strings.ReplaceAll(acc.Name, " ", "-")
 			if i > 0 {
 				profile = fmt.Sprintf("%s-%s", profile, Snake(r))
 			}
 
-			cs.Item.AccountName = acc.Name
-			cs.Item.Region = c.Region
-			cs.Item.ProfileName = strings.ToLower(profile)
+			p := &Credential{
+				ProfileName: strings.ToLower(profile),
+				AccountID:   acc.ID,
+				AccountName: acc.Name,
+				RoleName:    r,
+			}
+			a.Profile.Apply(p, c.Region)
+
+			profiles = append(profiles, p)
+		}
+	}
+
+	return profiles
+}
 
-			logger.Info().Str("account", acc.Name).Str("region", c.Region).Msgf("credentials profile %s", cs.Item.ProfileName)
+// GetCredentials retrieves the credentials of the account assigned to the user
+func (a *SSO) GetCredentials(c *SSOCredential, accounts []*Account) ([]*Credential, error) {
+	var creds []*Credential
+	for _, p := range a.Profiles(c, accounts) {
+		out, err := a.Cmd.GetRoleCredentials(c.AccessToken, c.Region, p.AccountID, p.RoleName)
+		if err != nil {
+			return nil, err
+		}
 
-			creds = append(creds, cs.Item)
+		cs := &Credentials{}
+		if err := json.Unmarshal([]byte(out), cs); err != nil {
+			return nil, err
 		}
+
+		logger.Debug().Interface("credentials", cs).Str("accountID", p.AccountID).Str("role", p.RoleName).Msg("credentials...")
+
+		cs.Item.AccountID = p.AccountID
+		cs.Item.AccountName = p.AccountName
+		cs.Item.RoleName = p.RoleName
+		cs.Item.Region = p.Region
+		cs.Item.Keys = p.Keys
+		cs.Item.ProfileName = p.ProfileName
+
+		logger.Info().Str("account", p.AccountName).Str("region", p.Region).Msgf("credentials profile %s", cs.Item.ProfileName)
+
+		creds = append(creds, cs.Item)
 	}
 
 	logger.Debug().Msgf("%d credentials have been generated", len(creds))
@@ -297,66 +583,289 @@ func (a *SSO) GetCredentials(c *SSOCredential, accounts []*Account) ([]*Credenti
 	return creds, nil
 }
 
-// PersistCredentials writes the credentials to the AWS file
-func (a *SSO) PersistCredentials(creds []*Credential) (*CredentialResultInfo, error) {
-	cred := NewFile(awsPath, "credentials")
+// PersistProfiles writes a sso profile for each account role to the AWS config file, the AWS SDKs
+// resolve the credentials through the sso-session. The profiles previously written by asl
+// that are no longer assigned to the user are removed.
+func (a *SSO) PersistProfiles(profiles []*Credential) (*CredentialResultInfo, error) {
+	if len(profiles) == 0 {
+		return nil, errors.New("no profiles were found")
+	}
 
-	if a.BackupFile {
-		filename, err := cred.Backup()
-		if err != nil {
-			return nil, err
-		}
+	config, err := a.file(a.Files.Config)
+	if err != nil {
+		return nil, err
+	}
 
-		logger.Info().Str("path", filename).Msg("backup completed successfully")
+	if err := a.backup(config); err != nil {
+		return nil, err
 	}
 
-	cfg, _ := ini.LooseLoad(cred.FullName)
+	err = config.Update(func(b []byte) ([]byte, error) {
+		cfg := ParseIni(b)
 
-	for _, c := range creds {
-		s := cfg.Section(c.ProfileName)
-		s.Key("output").SetValue("json")
-		s.Key(keyRegion).SetValue(c.Region)
-		s.Key(keyCrdAccessKeyID).SetValue(c.AccessKeyID)
-		s.Key(keyCrdSecretAccessKey).SetValue(c.SecretAccessKey)
-		s.Key(keyCrdSessionToken).SetValue(c.SessionToken)
-	}
+		current := map[string]bool{profileSection(a.Bootstrap): true}
+		for _, p := range profiles {
+			s := profileSection(p.ProfileName)
+			current[s] = true
+
+			if cfg.HasSection(s) && !managed(cfg, s) {
+				logger.Warn().Str("profile", p.ProfileName).Msg("skipping the profile that already exists and it is not managed by asl")
+				a.Report.AddFailure(&FailureReport{Profile: p.ProfileName, Reason: reasonUnmanaged})
+				continue
+			}
+
+			cfg.AddSection(s, managedComment)
+			cfg.Set(s, keySSOSession, a.Session)
+			cfg.Set(s, keySSOAccountID, p.AccountID)
+			cfg.Set(s, keySSORoleName, p.RoleName)
+			cfg.Set(s, keyRegion, p.Region)
+			for _, k := range p.SortedKeys() {
+				cfg.Set(s, k, p.Keys[k])
+			}
+
+			logger.Info().Str("account", p.AccountName).Str("role", p.RoleName).Msgf("sso profile %s", p.ProfileName)
+		}
+
+		a.persistChainedProfiles(cfg, profiles, current)
 
-	if err := cfg.SaveTo(cred.FullName); err != nil {
+		for _, s := range cfg.Sections() {
+			session, _ := cfg.Get(s, keySSOSession)
+			_, chained := cfg.Get(s, keySourceProfile)
+			if current[s] || (session != a.Session && !chained) || !managed(cfg, s) {
+				continue
+			}
+
+			cfg.DeleteSection(s)
+			logger.Info().Str("section", s).Msg("removing the sso profile that is no longer assigned to the user")
+		}
+
+		return cfg.Bytes(), nil
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	return &CredentialResultInfo{
-		Filename:  cred.FullName,
-		ExpiresAt: creds[len(creds)-1].ExpiresAt(),
+		Filename: a.Files.Config,
 	}, nil
 }
 
+// persistChainedProfiles writes a profile for each chained profile that assumes the role through
+// the source_profile setting, the aws cli and sdks assume the role with the sso profile credentials
+func (a *SSO) persistChainedProfiles(cfg *IniFile, profiles []*Credential, current map[string]bool) {
+	for _, p := range a.Chained {
+		source := p.Source(profiles)
+		if source == nil {
+			logger.Warn().Str("profile", p.Name).Str("account", p.SourceAccount).Str("role", p.SourceRole).Msg("skipping the chained profile, the source account and role are not assigned to the user")
+			a.Report.AddFailure(&FailureReport{Profile: p.Name, Reason: reasonNotAssigned})
+			continue
+		}
+
+		s := profileSection(p.Name)
+		current[s] = true
+
+		if cfg.HasSection(s) && !managed(cfg, s) {
+			logger.Warn().Str("profile", p.Name).Msg("skipping the profile that already exists and it is not managed by asl")
+			a.Report.AddFailure(&FailureReport{Profile: p.Name, Reason: reasonUnmanaged})
+			continue
+		}
+
+		region := source.Region
+		if p.Region != "" {
+			region = p.Region
+		}
+
+		cfg.AddSection(s, managedComment)
+		cfg.Set(s, keyRoleARN, p.RoleARN)
+		cfg.Set(s, keySourceProfile, source.ProfileName)
+		cfg.Set(s, keyRegion, region)
+
+		duration := ""
+		if p.DurationSeconds > 0 {
+			duration = fmt.Sprint(p.DurationSeconds)
+		}
+
+		for _, o := range []struct{ key, value string }{
+			{keyExternalID, p.ExternalID},
+			{keyRoleSessionName, p.SessionName},
+			{keyMFASerial, p.MFASerial},
+			{keyDurationSeconds, duration},
+		} {
+			if o.value != "" {
+				cfg.Set(s, o.key, o.value)
+			} else {
+				cfg.DeleteKey(s, o.key)
+			}
+		}
+
+		logger.Info().Str("source", source.ProfileName).Str("role", p.RoleARN).Msgf("chained profile %s", p.Name)
+	}
+}
+
+// PersistCredentials writes the credentials to the AWS file
+func (a *SSO) PersistCredentials(creds []*Credential) (*CredentialResultInfo, error) {
+	cred, err := a.file(a.Files.Credentials)
+	if err != nil {
+		return nil, err
+	}
+	cred.Secret = a.Secrets == nil
+
+	if err := a.backup(cred); err != nil {
+		return nil, err
+	}
+
+	if err := a.storeCredentials(creds); err != nil {
+		return nil, err
+	}
+
+	err = cred.Update(func(b []byte) ([]byte, error) {
+		cfg := ParseIni(b)
+
+		for _, c := range creds {
+			for _, k := range c.SortedKeys() {
+				cfg.Set(c.ProfileName, k, c.Keys[k])
+			}
+			cfg.Set(c.ProfileName, keyRegion, c.Region)
+			cfg.Set(c.ProfileName, keyExpiration, c.ExpiresAt().UTC().Format(time.RFC3339))
+
+			if a.Secrets != nil {
+				cfg.DeleteKey(c.ProfileName, keyCrdAccessKeyID)
+				cfg.DeleteKey(c.ProfileName, keyCrdSecretAccessKey)
+				cfg.DeleteKey(c.ProfileName, keyCrdSessionToken)
+				cfg.Set(c.ProfileName, keyCredentialProcess, credentialProcessCommand(a.SecretStore, c.ProfileName))
+				continue
+			}
+
+			cfg.DeleteKey(c.ProfileName, keyCredentialProcess)
+			cfg.Set(c.ProfileName, keyCrdAccessKeyID, c.AccessKeyID)
+			cfg.Set(c.ProfileName, keyCrdSecretAccessKey, c.SecretAccessKey)
+			cfg.Set(c.ProfileName, keyCrdSessionToken, c.SessionToken)
+		}
+
+		return cfg.Bytes(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &CredentialResultInfo{
+		Filename:    a.Files.Credentials,
+		Expirations: map[string]time.Time{},
+	}
+
+	for _, c := range creds {
+		exp := c.ExpiresAt()
+		res.Expirations[c.ProfileName] = exp
+		if res.ExpiresAt.IsZero() || exp.Before(res.ExpiresAt) {
+			res.ExpiresAt = exp
+		}
+	}
+
+	return res, nil
+}
+
 // ReadCacheFile reads the sso cache file for a given sso
 func (a *SSO) ReadCacheFile() (*SSOCredential, error) {
+	// the aws cli names the cache file after the sso-session, or after the start url for legacy profiles
+	key := a.StartURL
+	if a.SSOProfiles {
+		key = a.Session
+	}
+
 	hash := sha1.New()
-	_, err := hash.Write([]byte(a.StartURL))
+	_, err := hash.Write([]byte(key))
 	if err != nil {
 		return nil, err
 	}
 
 	cacheFilename := strings.ToLower(hex.EncodeToString(hash.Sum(nil))) + ".json"
-	cache := NewFile(awsPath, awsSSOPath, "cache", cacheFilename)
+	cache := NewFile(a.Files.SSOCache, cacheFilename)
+	cache.Secret = true
 
 	logger.Debug().Str("path", cache.FullName).Msg("searching for the aws sso cache file...")
 
+	// the sso profiles need the aws cli cache file, otherwise the token is kept in the secret store
+	store := a.Secrets
+	if a.SSOProfiles {
+		store = nil
+	}
+
 	if !cache.Exists() {
 		logger.Debug().Str("path", cache.FullName).Msg("aws sso cache file not found")
-		return nil, os.ErrNotExist
+		if store == nil {
+			return nil, os.ErrNotExist
+		}
+
+		b, err := store.Get(secretTokenPrefix + cacheFilename)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, os.ErrNotExist
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		data := &SSOCredential{}
+		if err := json.Unmarshal(b, data); err != nil {
+			return nil, err
+		}
+
+		logger.Debug().Interface("data", data).Msg("the sso access token was read from the secret store")
+
+		return data, nil
+	}
+
+	b, err := cache.Read()
+	if err != nil {
+		return nil, err
 	}
 
 	data := &SSOCredential{}
-	if err := cache.ReadJSON(data); err != nil {
+	if err := json.Unmarshal(b, data); err != nil {
 		return nil, err
 	}
 
 	logger.Debug().Interface("data", data).Msg("cache file was read successfully")
 
-	return data, err
+	// a new token written by aws sso login is moved to the secret store, the dry run does not change it
+	if store != nil && a.Sandbox == nil {
+		if err := store.Set(secretTokenPrefix+cacheFilename, b); err != nil {
+			return nil, err
+		}
+
+		if err := os.Remove(cache.FullName); err != nil {
+			return nil, err
+		}
+
+		logger.Info().Str("path", cache.FullName).Msg("the sso access token has been moved to the secret store")
+	}
+
+	return data, nil
+}
+
+// storeCredentials writes the credentials to the secret store in the credential_process format,
+// the dry run does not change the secret store
+func (a *SSO) storeCredentials(creds []*Credential) error {
+	if a.Secrets == nil {
+		return nil
+	}
+
+	for _, c := range creds {
+		if a.Sandbox != nil {
+			logger.Debug().Str("profile", c.ProfileName).Msg("dry run, the credentials are not written to the secret store")
+			continue
+		}
+
+		b, err := json.Marshal(c.CredentialProcess())
+		if err != nil {
+			return err
+		}
+
+		if err := a.Secrets.Set(secretCredPrefix+c.ProfileName, b); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
 func init() {
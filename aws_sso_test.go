@@ -1,6 +1,14 @@
 package main
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
 
 type SSOMock struct{}
 
@@ -9,15 +17,190 @@ func (c *SSOMock) Login(roleName string) (string, error) {
 }
 
 func (c *SSOMock) ListAccounts(accessToken string, region string) (string, error) {
-	return "", nil
+	return `{"accountList": [{"accountId": "123456789012", "accountName": "My Account"}, {"accountId": "210987654321", "accountName": "Mine"}]}`, nil
 }
 
 func (c *SSOMock) ListAccountRoles(accessToken string, region string, accountID string) (string, error) {
-	return "", nil
+	if accountID == "123456789012" {
+		return `{"roleList": [{"roleName": "AdministratorAccess"}, {"roleName": "ReadOnly"}]}`, nil
+	}
+	return `{"roleList": [{"roleName": "ReadOnly"}]}`, nil
 }
 
 func (c *SSOMock) GetRoleCredentials(accessToken string, region string, accountID string, roleName string) (string, error) {
 	return "", nil
 }
 
-func TestX(t *testing.T) {}
+func withAWSPath(t *testing.T) string {
+	dir := t.TempDir()
+	old := awsPath
+	awsPath = dir
+	t.Cleanup(func() { awsPath = old })
+	return dir
+}
+
+func TestPersistConfigBootstrapProfile(t *testing.T) {
+	dir := withAWSPath(t)
+	config := filepath.Join(dir, "config")
+	_ = os.WriteFile(config, []byte(`[profile MyRole]
+output = json
+region = us-east-1
+sso_start_url = https://foo.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 123456789012
+sso_role_name = MyRole
+
+[profile other]
+region = sa-east-1
+`), 0600)
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{
+		AccountID: "123456789012",
+		RoleName:  "MyRole",
+		StartURL:  "https://foo.awsapps.com/start",
+		Region:    "us-east-1",
+	})
+	err := sso.PersistConfig()
+	require.Nil(t, err)
+
+	b, _ := os.ReadFile(config)
+	require.Equal(t, `[profile other]
+region = sa-east-1
+
+`+managedComment+`
+[profile asl-bootstrap]
+output = json
+region = us-east-1
+sso_start_url = https://foo.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 123456789012
+sso_role_name = MyRole
+`, string(b))
+
+	err = sso.PersistConfig()
+	require.Nil(t, err)
+
+	again, _ := os.ReadFile(config)
+	require.Equal(t, string(b), string(again))
+}
+
+func TestPersistConfigRefusesUnmanagedProfile(t *testing.T) {
+	dir := withAWSPath(t)
+	config := filepath.Join(dir, "config")
+	_ = os.WriteFile(config, []byte("[profile other]\nregion = sa-east-1\n"), 0600)
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{RoleName: "MyRole", Bootstrap: "other"})
+	err := sso.PersistConfig()
+	require.NotNil(t, err)
+
+	b, _ := os.ReadFile(config)
+	require.Equal(t, "[profile other]\nregion = sa-east-1\n", string(b))
+}
+
+func TestPersistProfiles(t *testing.T) {
+	dir := withAWSPath(t)
+	config := filepath.Join(dir, "config")
+	_ = os.WriteFile(config, []byte(`[profile mine]
+region = sa-east-1
+
+`+managedComment+`
+[profile removed]
+sso_session = asl
+sso_account_id = 000000000000
+`), 0600)
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{SSOProfiles: true})
+	accounts := []*Account{
+		{ID: "123456789012", Name: "My Account", Roles: []string{"AdministratorAccess", "ReadOnly"}},
+		{ID: "210987654321", Name: "Mine", Roles: []string{"ReadOnly"}},
+	}
+	profiles := sso.Profiles(&SSOCredential{Region: "us-east-1"}, accounts)
+	require.Equal(t, "my-account-read-only", profiles[1].ProfileName)
+
+	res, err := sso.PersistProfiles(profiles)
+	require.Nil(t, err)
+	require.Equal(t, config, res.Filename)
+
+	b, _ := os.ReadFile(config)
+	require.Equal(t, `[profile mine]
+region = sa-east-1
+
+`+managedComment+`
+[profile my-account]
+sso_session = asl
+sso_account_id = 123456789012
+sso_role_name = AdministratorAccess
+region = us-east-1
+output = json
+
+`+managedComment+`
+[profile my-account-read-only]
+sso_session = asl
+sso_account_id = 123456789012
+sso_role_name = ReadOnly
+region = us-east-1
+output = json
+`, string(b))
+}
+
+func TestNewAWSFiles(t *testing.T) {
+	dir := withAWSPath(t)
+	t.Setenv(awsConfigFileEnv, "")
+	t.Setenv(awsCredentialsFileEnv, "")
+
+	f := NewAWSFiles(&ConfigOptions{})
+	require.Equal(t, &AWSFiles{
+		Config:      filepath.Join(dir, "config"),
+		Credentials: filepath.Join(dir, "credentials"),
+		SSOCache:    filepath.Join(dir, "sso", "cache"),
+	}, f)
+
+	t.Setenv(awsConfigFileEnv, "/tmp/aws/config")
+	t.Setenv(awsCredentialsFileEnv, "/tmp/aws/credentials")
+	f = NewAWSFiles(&ConfigOptions{AWSCredentialsFile: "/tmp/flag/credentials", SSOCacheDir: "/tmp/flag/cache"})
+	require.Equal(t, &AWSFiles{
+		Config:      "/tmp/aws/config",
+		Credentials: "/tmp/flag/credentials",
+		SSOCache:    "/tmp/flag/cache",
+	}, f)
+
+	env, err := f.CliEnv(nil)
+	require.Nil(t, err)
+	require.Equal(t, []string{"AWS_CONFIG_FILE=/tmp/aws/config", "AWS_SHARED_CREDENTIALS_FILE=/tmp/flag/credentials"}, env)
+}
+
+func TestPersistCredentialsExpirations(t *testing.T) {
+	dir := withAWSPath(t)
+	withPermissions(t, &PermissionPolicy{})
+
+	short := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+	long := short.Add(11 * time.Hour)
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{})
+	res, err := sso.PersistCredentials([]*Credential{
+		{ProfileName: "admin", Region: "us-east-1", AccessKeyID: "A", Expiration: long.UnixNano() / int64(time.Millisecond)},
+		{ProfileName: "read-only", Region: "us-east-1", AccessKeyID: "B", Expiration: short.UnixNano() / int64(time.Millisecond)},
+	})
+	require.Nil(t, err)
+	require.Equal(t, short, res.ExpiresAt.UTC())
+	require.Len(t, res.Expirations, 2)
+
+	b, _ := os.ReadFile(filepath.Join(dir, "credentials"))
+	require.Contains(t, string(b), "aws_expiration = 2030-01-01T21:00:00Z")
+	require.Contains(t, string(b), "aws_expiration = 2030-01-01T10:00:00Z")
+}
+
+func TestCredentialResultSummary(t *testing.T) {
+	now := time.Now()
+	res := &CredentialResultInfo{ExpiresAt: now.Add(8 * time.Hour)}
+	require.Equal(t, "note that it will expire at "+formatExpiration(res.ExpiresAt), res.Summary(time.Hour))
+
+	res.Expirations = map[string]time.Time{"admin": now.Add(8 * time.Hour), "read-only": now.Add(8 * time.Hour)}
+	require.Equal(t, "note that they will expire at "+formatExpiration(now.Add(8*time.Hour)), res.Summary(time.Hour))
+
+	res.Expirations = map[string]time.Time{"admin": now.Add(30 * time.Minute), "billing": now.Add(45 * time.Minute), "read-only": now.Add(12 * time.Hour)}
+	lines := strings.Split(res.Summary(time.Hour), "\n")
+	require.Equal(t, []string{
+		"note that they will expire between " + formatExpiration(now.Add(30*time.Minute)) + " (admin) and " + formatExpiration(now.Add(12*time.Hour)) + " (read-only)",
+		"warning: the credentials of admin, billing expire in less than 1h0m0s",
+	}, lines)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	logger "github.com/rs/zerolog/log"
+)
+
+const (
+	defaultRoleSessionName = "asl"
+	minChainedDuration     = 900
+	// STS limits the sessions of role chaining to one hour
+	maxChainedDuration = 3600
+)
+
+var matchRoleARN = regexp.MustCompile(`^arn:aws[a-z-]*:iam::([0-9]{12}):role/(?:.*/)?([^/]+)$`)
+
+// ChainedProfile defines a profile whose credentials are obtained by assuming a role with
+// the credentials of a SSO account and role, the source account matches by ID or name
+type ChainedProfile struct {
+	Name            string `json:"name"`
+	SourceAccount   string `json:"sourceAccount"`
+	SourceRole      string `json:"sourceRole"`
+	RoleARN         string `json:"roleArn"`
+	ExternalID      string `json:"externalId,omitempty"`
+	SessionName     string `json:"sessionName,omitempty"`
+	DurationSeconds int    `json:"durationSeconds,omitempty"`
+	MFASerial       string `json:"mfaSerial,omitempty"`
+	Region          string `json:"region,omitempty"`
+}
+
+// AssumeRoleInput defines the request of the sts assume-role command
+type AssumeRoleInput struct {
+	RoleArn         string `json:"RoleArn"`
+	RoleSessionName string `json:"RoleSessionName"`
+	ExternalID      string `json:"ExternalId,omitempty"`
+	DurationSeconds int    `json:"DurationSeconds,omitempty"`
+	SerialNumber    string `json:"SerialNumber,omitempty"`
+	TokenCode       string `json:"TokenCode,omitempty"`
+}
+
+// AssumeRoleOutput defines the structure returned by AWS Cli
+type AssumeRoleOutput struct {
+	Credentials *struct {
+		AccessKeyID     string    `json:"AccessKeyId"`
+		SecretAccessKey string    `json:"SecretAccessKey"`
+		SessionToken    string    `json:"SessionToken"`
+		Expiration      time.Time `json:"Expiration"`
+	} `json:"Credentials"`
+}
+
+// Source returns the credential of the SSO account and role used to assume the role
+func (p *ChainedProfile) Source(creds []*Credential) *Credential {
+	for _, c := range creds {
+		if (c.AccountID == p.SourceAccount || c.AccountName == p.SourceAccount) && c.RoleName == p.SourceRole {
+			return c
+		}
+	}
+	return nil
+}
+
+// Validate checks the chained profile
+func (p *ChainedProfile) Validate() []string {
+	var errs []string
+	if p.Name == "" {
+		errs = append(errs, "name: is required")
+	}
+	if p.SourceAccount == "" || p.SourceRole == "" {
+		errs = append(errs, "sourceAccount and sourceRole: are required")
+	}
+	if !matchRoleARN.MatchString(p.RoleARN) {
+		errs = append(errs, fmt.Sprintf("roleArn: %q is not a valid role ARN, e.g. arn:aws:iam::123456789012:role/MyRole", p.RoleARN))
+	}
+	if p.DurationSeconds != 0 && (p.DurationSeconds < minChainedDuration || p.DurationSeconds > maxChainedDuration) {
+		errs = append(errs, fmt.Sprintf("durationSeconds: %d must be between %d and %d, STS limits role chaining to one hour", p.DurationSeconds, minChainedDuration, maxChainedDuration))
+	}
+	if p.Region != "" && !matchRegion.MatchString(p.Region) {
+		errs = append(errs, fmt.Sprintf("region: %q is not a valid AWS region", p.Region))
+	}
+	return errs
+}
+
+// AssumeRoles assumes the role of each chained profile with the credentials of its source SSO account and role
+func (a *SSO) AssumeRoles(creds []*Credential) ([]*Credential, error) {
+	var chained []*Credential
+	for _, p := range a.Chained {
+		source := p.Source(creds)
+		if source == nil {
+			logger.Warn().Str("profile", p.Name).Str("account", p.SourceAccount).Str("role", p.SourceRole).Msg("skipping the chained profile, the source account and role are not assigned to the user")
+			a.Report.AddFailure(&FailureReport{Profile: p.Name, Reason: reasonNotAssigned})
+			continue
+		}
+
+		c, err := a.assumeRole(p, source)
+		if err != nil {
+			return nil, fmt.Errorf("assuming the role %s of the chained profile %s: %w", p.RoleARN, p.Name, err)
+		}
+
+		// the account name is known only when the role account is assigned to the user too
+		for _, sc := range creds {
+			if sc.AccountID == c.AccountID {
+				c.AccountName = sc.AccountName
+				break
+			}
+		}
+
+		logger.Info().Str("source", source.ProfileName).Str("role", p.RoleARN).Msgf("chained credentials profile %s", c.ProfileName)
+
+		chained = append(chained, c)
+	}
+
+	return chained, nil
+}
+
+func (a *SSO) assumeRole(p *ChainedProfile, source *Credential) (*Credential, error) {
+	m := matchRoleARN.FindStringSubmatch(p.RoleARN)
+	if m == nil {
+		return nil, fmt.Errorf("%q is not a valid role ARN", p.RoleARN)
+	}
+
+	in := &AssumeRoleInput{
+		RoleArn:         p.RoleARN,
+		RoleSessionName: p.SessionName,
+		ExternalID:      p.ExternalID,
+		DurationSeconds: p.DurationSeconds,
+		SerialNumber:    p.MFASerial,
+	}
+
+	if in.RoleSessionName == "" {
+		in.RoleSessionName = defaultRoleSessionName
+	}
+
+	if p.MFASerial != "" {
+		if a.MFAToken == nil {
+			return nil, fmt.Errorf("the mfa code of %s can not be asked", p.MFASerial)
+		}
+
+		code, err := a.MFAToken(p.MFASerial)
+		if err != nil {
+			return nil, err
+		}
+		in.TokenCode = code
+	}
+
+	input, err := json.Marshal(in)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := a.STS.AssumeRole(source, source.Region, input)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &AssumeRoleOutput{}
+	if err := json.Unmarshal([]byte(out), res); err != nil {
+		return nil, err
+	}
+
+	if res.Credentials == nil {
+		return nil, fmt.Errorf("no credentials were returned")
+	}
+
+	c := &Credential{
+		ProfileName:     p.Name,
+		AccountID:       m[1],
+		RoleName:        m[2],
+		AccessKeyID:     res.Credentials.AccessKeyID,
+		SecretAccessKey: res.Credentials.SecretAccessKey,
+		SessionToken:    res.Credentials.SessionToken,
+		Expiration:      res.Credentials.Expiration.UnixNano() / int64(time.Millisecond),
+	}
+
+	// the region of the chained profile takes precedence over the profile options
+	a.Profile.Apply(c, source.Region)
+	if p.Region != "" {
+		c.Region = p.Region
+	}
+
+	return c, nil
+}
+
+// mfaPrompt asks for the mfa code in the terminal
+func mfaPrompt(p *Prompt) func(string) (string, error) {
+	return func(serial string) (string, error) {
+		return p.Ask("MFA code for "+serial, "", func(v string) error {
+			if len(v) != 6 || strings.Trim(v, "0123456789") != "" {
+				return fmt.Errorf("%q must have 6 digits", v)
+			}
+			return nil
+		})
+	}
+}
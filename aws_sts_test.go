@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+type STSMock struct {
+	source *Credential
+	input  *AssumeRoleInput
+}
+
+func (c *STSMock) AssumeRole(source *Credential, region string, input []byte) (string, error) {
+	c.source = source
+	c.input = &AssumeRoleInput{}
+	if err := json.Unmarshal(input, c.input); err != nil {
+		return "", err
+	}
+
+	return `{"Credentials": {"AccessKeyId": "ASIACHAINED", "SecretAccessKey": "chained-secret", "SessionToken": "chained-token", "Expiration": "2030-01-01T00:00:00+00:00"}}`, nil
+}
+
+var chainedProfiles = []*ChainedProfile{
+	{Name: "prod-deploy", SourceAccount: "My Account", SourceRole: "ReadOnly", RoleARN: "arn:aws:iam::999999999999:role/ci/Deploy",
+		ExternalID: "ext-1", DurationSeconds: 3600, MFASerial: "arn:aws:iam::123456789012:mfa/me", Region: "eu-west-1"},
+	{Name: "missing", SourceAccount: "Other", SourceRole: "ReadOnly", RoleARN: "arn:aws:iam::999999999999:role/Deploy"},
+}
+
+func TestAssumeRoles(t *testing.T) {
+	sts := &STSMock{}
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{ChainedProfiles: chainedProfiles})
+	sso.STS = sts
+	sso.MFAToken = func(serial string) (string, error) { return "123456", nil }
+
+	source := &Credential{ProfileName: "my-account-read-only", AccountID: "123456789012", AccountName: "My Account", RoleName: "ReadOnly", Region: "us-east-1", AccessKeyID: "ASIASOURCE"}
+	creds, err := sso.AssumeRoles([]*Credential{source})
+	require.Nil(t, err)
+	require.Len(t, creds, 1)
+
+	require.Equal(t, source, sts.source)
+	require.Equal(t, &AssumeRoleInput{RoleArn: "arn:aws:iam::999999999999:role/ci/Deploy", RoleSessionName: "asl", ExternalID: "ext-1",
+		DurationSeconds: 3600, SerialNumber: "arn:aws:iam::123456789012:mfa/me", TokenCode: "123456"}, sts.input)
+
+	c := creds[0]
+	require.Equal(t, "prod-deploy", c.ProfileName)
+	require.Equal(t, "999999999999", c.AccountID)
+	require.Equal(t, "Deploy", c.RoleName)
+	require.Equal(t, "eu-west-1", c.Region)
+	require.Equal(t, "ASIACHAINED", c.AccessKeyID)
+	require.Equal(t, int64(1893456000000), c.Expiration)
+}
+
+func TestAssumeRolesInvalidARN(t *testing.T) {
+	sts := &STSMock{}
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{ChainedProfiles: []*ChainedProfile{
+		{Name: "invalid", SourceAccount: "123456789012", SourceRole: "ReadOnly", RoleARN: "arn:aws:iam::1:role/x"},
+	}})
+	sso.STS = sts
+
+	_, err := sso.AssumeRoles([]*Credential{{AccountID: "123456789012", RoleName: "ReadOnly"}})
+	require.EqualError(t, err, `assuming the role arn:aws:iam::1:role/x of the chained profile invalid: "arn:aws:iam::1:role/x" is not a valid role ARN`)
+	require.Nil(t, sts.input)
+}
+
+func TestPersistChainedProfiles(t *testing.T) {
+	dir := withAWSPath(t)
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{SSOProfiles: true, ChainedProfiles: chainedProfiles[:1]})
+	profiles := sso.Profiles(&SSOCredential{Region: "us-east-1"}, []*Account{
+		{ID: "123456789012", Name: "My Account", Roles: []string{"AdministratorAccess", "ReadOnly"}},
+	})
+
+	_, err := sso.PersistProfiles(profiles)
+	require.Nil(t, err)
+
+	b, _ := os.ReadFile(filepath.Join(dir, "config"))
+	require.Contains(t, string(b), managedComment+`
+[profile prod-deploy]
+role_arn = arn:aws:iam::999999999999:role/ci/Deploy
+source_profile = my-account-read-only
+region = eu-west-1
+external_id = ext-1
+mfa_serial = arn:aws:iam::123456789012:mfa/me
+duration_seconds = 3600
+`)
+
+	sso.Chained = nil
+	_, err = sso.PersistProfiles(profiles)
+	require.Nil(t, err)
+
+	b, _ = os.ReadFile(filepath.Join(dir, "config"))
+	require.NotContains(t, string(b), "prod-deploy")
+}
+
+func TestLoadConfigChainedProfiles(t *testing.T) {
+	withASLPath(t, `{"startUrl": "https://my-company.awsapps.com/start", "region": "us-east-1", "accountId": "123456789012", "roleName": "Developer"}`)
+
+	values := &ConfigOptions{}
+	flags := pflag.NewFlagSet("asl", pflag.ContinueOnError)
+	AddConfigFlags(flags, values)
+	require.Nil(t, flags.Parse([]string{"--chained-profiles", `[{"name": "prod-deploy", "sourceAccount": "123456789012", "sourceRole": "Developer", "roleArn": "arn:aws:iam::999999999999:role/Deploy"}]`}))
+
+	cfg, err := LoadConfig(flags, values)
+	require.Nil(t, err)
+	require.Nil(t, cfg.Validate())
+	require.Equal(t, []*ChainedProfile{
+		{Name: "prod-deploy", SourceAccount: "123456789012", SourceRole: "Developer", RoleARN: "arn:aws:iam::999999999999:role/Deploy"},
+	}, cfg.ChainedProfiles)
+	require.Equal(t, SourceFlag, cfg.Source("chainedProfiles"))
+}
+
+func TestChainedProfileValidate(t *testing.T) {
+	p := &ChainedProfile{Name: "x", SourceAccount: "1", SourceRole: "r", RoleARN: "arn:aws:iam::1:role/x", DurationSeconds: 60}
+	require.Equal(t, []string{
+		`roleArn: "arn:aws:iam::1:role/x" is not a valid role ARN, e.g. arn:aws:iam::123456789012:role/MyRole`,
+		"durationSeconds: 60 must be between 900 and 3600, STS limits role chaining to one hour",
+	}, p.Validate())
+
+	p = &ChainedProfile{Name: "x", SourceAccount: "1", SourceRole: "r", RoleARN: "arn:aws:iam::123456789012:role/x", DurationSeconds: 43200}
+	require.Equal(t, []string{"durationSeconds: 43200 must be between 900 and 3600, STS limits role chaining to one hour"}, p.Validate())
+}
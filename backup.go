@@ -0,0 +1,335 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+	logger "github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	backupIndexFile   = "index.json"
+	backupIDLayout    = "20060102T150405.000"
+	defaultBackupKeep = 10
+)
+
+var backupPath string
+
+// BackupRetention defines how many backups are kept for each file
+type BackupRetention struct {
+	Count      int `json:"count,omitempty"`
+	MaxAgeDays int `json:"maxAgeDays,omitempty"`
+}
+
+// Backup defines a copy of a configuration file
+type Backup struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+	Secret    bool      `json:"secret,omitempty"`
+}
+
+// BackupStore keeps the backups of the configuration files in a dedicated directory
+type BackupStore struct {
+	Path      string
+	Retention BackupRetention
+}
+
+// NewBackupStore returns a new BackupStore
+func NewBackupStore(c *ConfigOptions) *BackupStore {
+	s := &BackupStore{
+		Path:      backupPath,
+		Retention: BackupRetention{Count: defaultBackupKeep},
+	}
+
+	if c != nil && c.BackupRetention != nil {
+		s.Retention = *c.BackupRetention
+	}
+
+	return s
+}
+
+func backupCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Manage the backups of the configuration files [.aws/config|.aws/credentials|kubeconfig]",
+	}
+
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "List the available backups",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := loadBackupStore(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			backups, err := store.List()
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "ID\tCREATED AT\tSOURCE")
+			for _, b := range backups {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", b.ID, b.CreatedAt.Local().Format(time.RFC3339), b.Source)
+			}
+
+			return w.Flush()
+		},
+	}
+
+	cmd.AddCommand(list, backupRestoreCmd(ctx))
+
+	return cmd
+}
+
+func backupRestoreCmd(ctx context.Context) *cobra.Command {
+	return &cobra.Command{
+		Use:   "restore <id>",
+		Short: "Restore a configuration file from a backup",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			store, err := loadBackupStore(cmd.Flags())
+			if err != nil {
+				return err
+			}
+
+			b, err := store.Restore(args[0])
+			if err != nil {
+				return err
+			}
+
+			logger.Info().Str("id", b.ID).Str("path", b.Source).Msg("the backup has been successfully restored")
+
+			return nil
+		},
+	}
+}
+
+// loadBackupStore returns the backup store using the retention of the asl config file, when it exists
+func loadBackupStore(flags *pflag.FlagSet) (*BackupStore, error) {
+	if !ConfigFile().Exists() && !NewFile(legacyASLPath).Exists() {
+		return NewBackupStore(nil), nil
+	}
+
+	cfg, err := LoadConfig(flags, flagConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBackupStore(cfg), nil
+}
+
+// Save makes a copy of the file and removes the backups beyond the retention,
+// it returns nil when the file does not exist
+func (s *BackupStore) Save(f *File) (*Backup, error) {
+	if !f.Exists() {
+		return nil, nil
+	}
+
+	content, err := f.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	source, err := filepath.Abs(f.FullName)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Backup{Source: source, CreatedAt: time.Now().UTC(), Secret: f.Secret}
+
+	err = s.index().Update(func(data []byte) ([]byte, error) {
+		backups, err := s.unmarshal(data)
+		if err != nil {
+			return nil, err
+		}
+
+		b.ID = s.newID(backups, b)
+		if err := s.file(b.ID).WriteAtomic(content); err != nil {
+			return nil, err
+		}
+
+		return json.MarshalIndent(s.prune(append(backups, b)), "", " ")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// List returns the backups sorted by creation date, the newest first
+func (s *BackupStore) List() ([]*Backup, error) {
+	idx := s.index()
+	if !idx.Exists() {
+		return nil, nil
+	}
+
+	data, err := idx.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	backups, err := s.unmarshal(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	return backups, nil
+}
+
+// Restore writes the backup content back to its source file,
+// the current content of the source file is backed up before
+func (s *BackupStore) Restore(id string) (*Backup, error) {
+	backups, err := s.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var b *Backup
+	for _, bkp := range backups {
+		if bkp.ID == id {
+			b = bkp
+			break
+		}
+	}
+
+	if b == nil {
+		return nil, fmt.Errorf("backup %s not found. please run: asl backup list", id)
+	}
+
+	content, err := s.file(b.ID).Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// the source keeps the kind of file it was when the backup was made
+	source := NewFile(b.Source)
+	source.Secret = b.Secret
+
+	current, err := s.Save(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if current != nil {
+		logger.Info().Str("id", current.ID).Str("path", current.Source).Msg("backup completed successfully")
+	}
+
+	err = source.Update(func([]byte) ([]byte, error) {
+		return content, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// file returns a backup file, it holds secrets when the source is the credentials file or a kubeconfig
+func (s *BackupStore) file(id string) *File {
+	f := NewFile(s.Path, id)
+	f.Secret = true
+	return f
+}
+
+func (s *BackupStore) index() *File {
+	return NewFile(s.Path, backupIndexFile)
+}
+
+func (s *BackupStore) unmarshal(data []byte) ([]*Backup, error) {
+	var backups []*Backup
+	if len(data) == 0 {
+		return backups, nil
+	}
+
+	if err := json.Unmarshal(data, &backups); err != nil {
+		return nil, fmt.Errorf("reading the backup index %s: %w", s.index().FullName, err)
+	}
+
+	return backups, nil
+}
+
+// newID returns a readable and unique identifier composed by the creation date
+// and the source file name, e.g. 20240101T101010.000-aws-credentials
+func (s *BackupStore) newID(backups []*Backup, b *Backup) string {
+	dir := strings.TrimPrefix(filepath.Base(filepath.Dir(b.Source)), ".")
+	name := strings.TrimPrefix(filepath.Base(b.Source), ".")
+	id := fmt.Sprintf("%s-%s-%s", b.CreatedAt.Format(backupIDLayout), dir, name)
+
+	exists := func(id string) bool {
+		for _, bkp := range backups {
+			if bkp.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	unique := id
+	for i := 1; exists(unique); i++ {
+		unique = fmt.Sprintf("%s-%d", id, i)
+	}
+
+	return unique
+}
+
+// prune removes the backups that exceed the count or the age of the retention for each source file
+func (s *BackupStore) prune(backups []*Backup) []*Backup {
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+
+	var kept []*Backup
+	count := map[string]int{}
+	for _, b := range backups {
+		count[b.Source]++
+
+		expired := s.Retention.MaxAgeDays > 0 && time.Since(b.CreatedAt) > time.Duration(s.Retention.MaxAgeDays)*24*time.Hour
+		exceeded := s.Retention.Count > 0 && count[b.Source] > s.Retention.Count
+		if !expired && !exceeded {
+			kept = append(kept, b)
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.Path, b.ID)); err != nil && !os.IsNotExist(err) {
+			logger.Warn().Err(err).Str("id", b.ID).Msg("error removing backup")
+			kept = append(kept, b)
+			continue
+		}
+
+		logger.Debug().Str("id", b.ID).Str("path", b.Source).Msg("backup removed by the retention policy")
+	}
+
+	return kept
+}
+
+func init() {
+	home, err := homedir.Dir()
+	if err != nil {
+		logger.Fatal().Err(err)
+	}
+
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		state = filepath.Join(home, ".local", "state")
+	}
+
+	backupPath = filepath.Join(state, "asl", "backups")
+}
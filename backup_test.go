@@ -0,0 +1,99 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackupSaveAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, ".aws", "credentials")
+	_ = os.MkdirAll(filepath.Dir(filename), 0750)
+	_ = os.WriteFile(filename, []byte("foo"), 0600)
+
+	s := &BackupStore{Path: filepath.Join(dir, "backups")}
+	b, err := s.Save(NewFile(filename))
+	require.Nil(t, err)
+	require.Equal(t, filename, b.Source)
+	require.Contains(t, b.ID, "-aws-credentials")
+
+	_ = os.WriteFile(filename, []byte("bar"), 0600)
+
+	_, err = s.Restore(b.ID)
+	require.Nil(t, err)
+
+	content, _ := os.ReadFile(filename)
+	require.Equal(t, "foo", string(content))
+
+	backups, _ := s.List()
+	require.Len(t, backups, 2)
+	require.Equal(t, b.ID, backups[1].ID)
+
+	_, err = s.Restore("foo")
+	require.NotNil(t, err)
+}
+
+func TestBackupRestoreKeepsTheSourceKind(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "config")
+	cred := filepath.Join(dir, "credentials")
+	_ = os.WriteFile(config, []byte("foo"), 0644)
+	_ = os.WriteFile(cred, []byte("foo"), 0644)
+
+	s := &BackupStore{Path: filepath.Join(dir, "backups")}
+	bc, err := s.Save(NewFile(config))
+	require.Nil(t, err)
+	require.False(t, bc.Secret)
+
+	f := NewFile(cred)
+	f.Secret = true
+	bs, err := s.Save(f)
+	require.Nil(t, err)
+	require.True(t, bs.Secret)
+
+	_, err = s.Restore(bc.ID)
+	require.Nil(t, err)
+	_, err = s.Restore(bs.ID)
+	require.Nil(t, err)
+
+	info, _ := os.Stat(config)
+	require.Equal(t, os.FileMode(0644), info.Mode().Perm())
+
+	info, _ = os.Stat(cred)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+}
+
+func TestBackupSaveMissingFile(t *testing.T) {
+	s := &BackupStore{Path: t.TempDir()}
+	b, err := s.Save(NewFile("/tmp/go-test-missing"))
+	require.Nil(t, err)
+	require.Nil(t, b)
+}
+
+func TestBackupRetentionCount(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "config")
+	_ = os.WriteFile(filename, []byte("foo"), 0600)
+
+	s := &BackupStore{Path: filepath.Join(dir, "backups"), Retention: BackupRetention{Count: 2}}
+	var last *Backup
+	for i := 0; i < 4; i++ {
+		last, _ = s.Save(NewFile(filename))
+	}
+
+	backups, _ := s.List()
+	require.Len(t, backups, 2)
+	require.Equal(t, last.ID, backups[0].ID)
+
+	entries, _ := os.ReadDir(s.Path)
+	var files int
+	for _, e := range entries {
+		if e.Name() != backupIndexFile {
+			files++
+		}
+	}
+	require.Equal(t, 2, files)
+}
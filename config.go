@@ -3,34 +3,108 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
+	"net/url"
+	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mitchellh/go-homedir"
 	logger "github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-var aslPath string
+var (
+	aslPath string
+
+	matchRegion    = regexp.MustCompile(`^[a-z]{2}(-gov|-iso[a-z]?)?-[a-z]+-[0-9]+$`)
+	matchAccountID = regexp.MustCompile(`^[0-9]{12}$`)
+)
+
+const defaultShortSession = time.Hour
 
 // ConfigOptions defines the ASL options
 type ConfigOptions struct {
-	AccountID     string `json:"accountId"`
-	RoleName      string `json:"roleName"`
-	StartURL      string `json:"startUrl"`
-	Region        string `json:"region"`
-	BackupFile    bool   `json:"-"`
-	ForceSSOLogin bool   `json:"-"`
+	Version            int               `json:"version"`
+	AccountID          string            `json:"accountId"`
+	RoleName           string            `json:"roleName"`
+	StartURL           string            `json:"startUrl"`
+	Region             string            `json:"region"`
+	Bootstrap          string            `json:"bootstrapProfile,omitempty"`
+	SSOProfiles        bool              `json:"ssoProfiles,omitempty"`
+	SSOSession         string            `json:"ssoSession,omitempty"`
+	Profiles           *ProfileOptions   `json:"profiles,omitempty"`
+	EKS                *EKSFilter        `json:"eks,omitempty"`
+	BackupRetention    *BackupRetention  `json:"backupRetention,omitempty"`
+	Portals            []*Portal         `json:"portals,omitempty"`
+	ChainedProfiles    []*ChainedProfile `json:"chainedProfiles,omitempty"`
+	SecretStore        string            `json:"secretStore,omitempty"`
+	KeepPermissions    bool              `json:"keepPermissions,omitempty"`
+	ShortSession       int               `json:"shortSessionMinutes,omitempty"`
+	BackupFile         bool              `json:"-"`
+	ForceSSOLogin      bool              `json:"-"`
+	EKSSplit           string            `json:"-"`
+	KubeConfig         string            `json:"-"`
+	KubeConfigDir      string            `json:"-"`
+	AWSConfigFile      string            `json:"-"`
+	AWSCredentialsFile string            `json:"-"`
+	SSOCacheDir        string            `json:"-"`
+	Portal             string            `json:"-"`
+	ForceInsecure      bool              `json:"-"`
+	Sources            map[string]string `json:"-"`
 }
 
 func configureCmd(ctx context.Context) *cobra.Command {
 	o := &ConfigOptions{}
 
+	var fromProfiles []string
+	var detect bool
+
 	cmd := &cobra.Command{
 		Use:   "configure",
 		Short: "Store the parameters used to log in to AWS SSO",
+		Long: `Store the parameters used to log in to AWS SSO.
+
+Without the --start-url, --region, --account-id and --role-name flags, an interactive
+prompt asks for the start URL and region, logs in to AWS SSO and lists the accounts
+and roles assigned to the user to choose the ones used to log in.
+
+The --from-profile and --detect flags import the sso profiles written by
+"aws configure sso" instead. Each start URL found becomes a portal, the first one
+is also used by default and any of them is chosen with: asl --portal <name>`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			logger.Debug().Str("aslPath", aslPath).Interface("options", o).Msg("configuring...")
 
+			interactive := true
+			for _, f := range []string{"start-url", "region", "account-id", "role-name"} {
+				interactive = interactive && !cmd.Flags().Changed(f)
+			}
+
+			if err := configureDefaults(cmd, o); err != nil {
+				return err
+			}
+
+			switch {
+			case detect || len(fromProfiles) > 0:
+				if err := importPortals(o, fromProfiles); err != nil {
+					return err
+				}
+			case interactive:
+				env, err := NewAWSFiles(o).CliEnv(nil)
+				if err != nil {
+					return err
+				}
+
+				p := NewPrompt(cmd.InOrStdin(), cmd.ErrOrStderr())
+				if err := ConfigureWizard(p, &SSOCli{Env: env}, o); err != nil {
+					return err
+				}
+			}
+
 			if err := Configure(o); err != nil {
 				return err
 			}
@@ -45,19 +119,336 @@ func configureCmd(ctx context.Context) *cobra.Command {
 	cmd.Flags().StringVarP(&o.RoleName, "role-name", "R", "", "the role name that is assigned to the user")
 	cmd.Flags().StringVarP(&o.StartURL, "start-url", "u", "", "the URL that points to the organization's AWS Single Sign-On (AWS SSO) user portal")
 	cmd.Flags().StringVarP(&o.Region, "region", "r", "", "the region to use")
+	cmd.Flags().BoolVar(&o.SSOProfiles, "sso-profiles", false, "write sso profiles to the aws config file instead of static credentials")
+	cmd.Flags().StringVar(&o.SSOSession, "sso-session", "", fmt.Sprintf("the sso-session referenced by the sso profiles (default %q)", DefaultSSOSession))
+	cmd.Flags().StringSliceVar(&fromProfiles, "from-profile", nil, "import the sso profiles of the aws config file")
+	cmd.Flags().BoolVar(&detect, "detect", false, "import all the sso profiles found in the aws config file")
+	cmd.Flags().StringVar(&o.Bootstrap, "bootstrap-profile", "", fmt.Sprintf("the profile written in the aws config file to log in to AWS SSO (default %q)", DefaultBootstrapProfile))
+
+	return cmd
+}
+
+func configCmd(ctx context.Context) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect, validate and migrate the asl configuration",
+	}
+
+	show := &cobra.Command{
+		Use:   "show",
+		Short: "Display the effective configuration values and their source [flag|env|file|default]",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
+			if err != nil {
+				return err
+			}
+
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+			fmt.Fprintln(w, "NAME\tVALUE\tSOURCE\tENV")
+			for _, f := range configFields {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", f.Name, cfg.FieldValue(f), cfg.Source(f.Name), f.Env())
+			}
+
+			return w.Flush()
+		},
+	}
+
+	validate := &cobra.Command{
+		Use:   "validate",
+		Short: "Check the effective configuration values",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
+			if err != nil {
+				return err
+			}
 
-	_ = cmd.MarkFlagRequired("account-id")
-	_ = cmd.MarkFlagRequired("role-name")
-	_ = cmd.MarkFlagRequired("start-url")
-	_ = cmd.MarkFlagRequired("region")
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			logger.Info().Msg("the asl config is valid")
+
+			return nil
+		},
+	}
+
+	var format string
+	migrate := &cobra.Command{
+		Use:   "migrate",
+		Short: "Move the legacy ~/.asl file to the current location and upgrade the config schema",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if f, err := MigrateConfig(); err != nil {
+				return err
+			} else if f != nil {
+				logger.Info().Str("from", legacyASLPath).Str("path", f.FullName).Msg("the legacy asl config file has been migrated")
+			}
+
+			config := ConfigFile()
+			if !config.Exists() {
+				return errors.New("asl config file not found. please run: asl configure")
+			}
+
+			o := &ConfigOptions{}
+			if err := ReadConfigFile(config, o); err != nil {
+				return err
+			}
+
+			if err := o.ValidateVersion(); err != nil {
+				return err
+			}
+			o.Version = ConfigVersion
+
+			target := config
+			if format != "" && format != configFormat(config) {
+				target = NewFile(aslPath + "." + format)
+				if format == FormatJSON {
+					target = NewFile(aslPath)
+				}
+			}
+
+			if err := WriteConfigFile(target, o, configFormat(target)); err != nil {
+				return err
+			}
+
+			if target.FullName != config.FullName {
+				if err := os.Remove(config.FullName); err != nil {
+					return err
+				}
+			}
+
+			logger.Info().Str("path", target.FullName).Int("version", o.Version).Msg("the asl config file is up to date")
+
+			return nil
+		},
+	}
+	migrate.Flags().StringVar(&format, "format", "", fmt.Sprintf("convert the asl config file to another format [%s|%s|%s]", FormatJSON, FormatYAML, FormatTOML))
+
+	cmd.AddCommand(show, validate, migrate)
 
 	return cmd
 }
 
-// Configure writes the ASL parameters to use when needed
+// configureDefaults sets the values of the ASL_* environment variables and the root flags,
+// the configure flags take precedence over them
+func configureDefaults(cmd *cobra.Command, o *ConfigOptions) error {
+	d := &ConfigOptions{Sources: map[string]string{}}
+	if err := applyOverrides(d, cmd.InheritedFlags(), flagConfig); err != nil {
+		return err
+	}
+
+	for _, f := range configFields {
+		if _, ok := d.Sources[f.Name]; ok && !cmd.Flags().Changed(f.Flag) {
+			copyConfigValue(f.Value(o), f.Value(d))
+		}
+	}
+
+	return nil
+}
+
+// importPortals stores the sso profiles of the aws config file as portals, the first
+// one is also the default portal, but the values given by flags are kept
+func importPortals(o *ConfigOptions, profiles []string) error {
+	config := NewFile(NewAWSFiles(o).Config)
+	if !config.Exists() {
+		return fmt.Errorf("the aws config file %s does not exist", config.FullName)
+	}
+
+	b, err := config.Read()
+	if err != nil {
+		return err
+	}
+
+	portals, err := ImportPortals(ParseIni(b), profiles)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range portals {
+		logger.Info().Str("portal", p.Name).Str("startUrl", p.StartURL).Str("accountId", p.AccountID).Str("roleName", p.RoleName).Msg("sso profile imported")
+	}
+
+	def := portals[0]
+	for _, v := range []struct {
+		field *string
+		value string
+	}{
+		{&o.StartURL, def.StartURL},
+		{&o.Region, def.Region},
+		{&o.AccountID, def.AccountID},
+		{&o.RoleName, def.RoleName},
+	} {
+		if *v.field == "" {
+			*v.field = v.value
+		}
+	}
+
+	o.Portals = portals
+
+	return nil
+}
+
+// ValidateVersion checks if the config schema is supported by this asl version
+func (o *ConfigOptions) ValidateVersion() error {
+	if o.Version > ConfigVersion {
+		return fmt.Errorf("the asl config schema version %d is newer than the supported version %d, please upgrade asl", o.Version, ConfigVersion)
+	}
+	return nil
+}
+
+// Validate checks the config values and reports all invalid fields at once
+func (o *ConfigOptions) Validate() error {
+	var errs []string
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf("  - %s: %s", name, fmt.Sprintf(format, args...)))
+	}
+
+	if err := o.ValidateVersion(); err != nil {
+		invalid("version", err.Error())
+	}
+
+	if err := validateStartURL(o.StartURL); err != nil {
+		invalid("startUrl", "%s", err)
+	}
+
+	if err := validateRegion(o.Region); err != nil {
+		invalid("region", "%s", err)
+	}
+
+	if o.AccountID == "" {
+		invalid("accountId", "is required")
+	} else if !matchAccountID.MatchString(o.AccountID) {
+		invalid("accountId", "%q must have 12 digits", o.AccountID)
+	}
+
+	if o.RoleName == "" {
+		invalid("roleName", "is required")
+	}
+
+	if o.Profiles != nil && o.Profiles.Region != "" && !matchRegion.MatchString(o.Profiles.Region) {
+		invalid("profiles.region", "%q is not a valid AWS region", o.Profiles.Region)
+	}
+
+	if o.Profiles != nil {
+		for i, ov := range o.Profiles.Overrides {
+			if ov.Region != "" && !matchRegion.MatchString(ov.Region) {
+				invalid(fmt.Sprintf("profiles.overrides[%d].region", i), "%q is not a valid AWS region", ov.Region)
+			}
+		}
+	}
+
+	names := map[string]bool{}
+	for i, p := range o.Portals {
+		name := fmt.Sprintf("portals[%d]", i)
+		if p.Name == "" {
+			invalid(name+".name", "is required")
+		} else if names[p.Name] {
+			invalid(name+".name", "%q is duplicated", p.Name)
+		}
+		names[p.Name] = true
+
+		if err := validateStartURL(p.StartURL); err != nil {
+			invalid(name+".startUrl", "%s", err)
+		}
+		if err := validateRegion(p.Region); err != nil {
+			invalid(name+".region", "%s", err)
+		}
+		if !matchAccountID.MatchString(p.AccountID) {
+			invalid(name+".accountId", "%q must have 12 digits", p.AccountID)
+		}
+		if p.RoleName == "" {
+			invalid(name+".roleName", "is required")
+		}
+	}
+
+	for i, p := range o.ChainedProfiles {
+		for _, e := range p.Validate() {
+			kv := strings.SplitN(e, ": ", 2)
+			invalid(fmt.Sprintf("chainedProfiles[%d].%s", i, kv[0]), "%s", kv[1])
+		}
+	}
+
+	switch o.SecretStore {
+	case "", SecretStoreFile, SecretStoreSecretService, SecretStoreVault:
+	default:
+		invalid("secretStore", "%q must be %s, %s or %s", o.SecretStore, SecretStoreFile, SecretStoreSecretService, SecretStoreVault)
+	}
+
+	if o.EKSSplit != "" && o.EKSSplit != EKSSplitByAccount && o.EKSSplit != EKSSplitByProfile {
+		invalid("eksSplit", "%q must be %s or %s", o.EKSSplit, EKSSplitByAccount, EKSSplitByProfile)
+	}
+
+	if o.BackupRetention != nil && (o.BackupRetention.Count < 0 || o.BackupRetention.MaxAgeDays < 0) {
+		invalid("backupRetention", "count and maxAgeDays must not be negative")
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid asl config:\n%s", strings.Join(errs, "\n"))
+	}
+
+	return nil
+}
+
+func validateStartURL(v string) error {
+	if v == "" {
+		return errors.New("is required, e.g. https://d-123456w78w.awsapps.com/start")
+	}
+
+	if u, err := url.Parse(v); err != nil || u.Scheme != "https" || u.Host == "" {
+		return fmt.Errorf("%q is not a valid https URL, e.g. https://d-123456w78w.awsapps.com/start", v)
+	}
+
+	return nil
+}
+
+func validateRegion(v string) error {
+	if v == "" {
+		return errors.New("is required, e.g. us-east-1")
+	}
+
+	if !matchRegion.MatchString(v) {
+		return fmt.Errorf("%q is not a valid AWS region, e.g. us-east-1", v)
+	}
+
+	return nil
+}
+
+// BootstrapProfileName returns the profile used to log in to AWS SSO
+func (o *ConfigOptions) BootstrapProfileName() string {
+	if o.Bootstrap != "" {
+		return o.Bootstrap
+	}
+	return DefaultBootstrapProfile
+}
+
+// ShortSessionDuration returns the duration below which the credentials are reported as short-lived
+func (o *ConfigOptions) ShortSessionDuration() time.Duration {
+	if o.ShortSession > 0 {
+		return time.Duration(o.ShortSession) * time.Minute
+	}
+	return defaultShortSession
+}
+
+// SSOSessionName returns the sso-session referenced by the sso profiles
+func (o *ConfigOptions) SSOSessionName() string {
+	if o.SSOSession != "" {
+		return o.SSOSession
+	}
+	return DefaultSSOSession
+}
+
+// Configure writes the ASL parameters to use when needed, the format of an existing file is kept
 func Configure(o *ConfigOptions) error {
-	config := NewFile(aslPath)
-	if err := config.WriteJSON(o); err != nil {
+	if _, err := MigrateConfig(); err != nil {
+		return err
+	}
+
+	o.Version = ConfigVersion
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	config := ConfigFile()
+	if err := WriteConfigFile(config, o, configFormat(config)); err != nil {
 		return err
 	}
 
@@ -67,26 +458,52 @@ func Configure(o *ConfigOptions) error {
 
 }
 
-// LoadConfig reads the ASL parameters
-func LoadConfig(opts *Options) (*ConfigOptions, error) {
-	config := NewFile(aslPath)
+// LoadConfig reads the ASL parameters, the precedence order is: flag > environment variable > config file.
+// The values of the changed flags are read from flagValues.
+func LoadConfig(flags *pflag.FlagSet, flagValues *ConfigOptions) (*ConfigOptions, error) {
+	if f, err := MigrateConfig(); err != nil {
+		return nil, err
+	} else if f != nil {
+		logger.Info().Str("from", legacyASLPath).Str("path", f.FullName).Msg("the legacy asl config file has been migrated")
+	}
 
-	if !config.Exists() {
-		return nil, errors.New("asl config file not found. please run: asl configure")
+	config := ConfigFile()
+
+	data := &ConfigOptions{Sources: map[string]string{}}
+	if config.Exists() {
+		logger.Info().Str("path", config.FullName).Msg("loading the asl config file")
+
+		if err := ReadConfigFile(config, data); err != nil {
+			return nil, err
+		}
+
+		if err := data.ValidateVersion(); err != nil {
+			return nil, err
+		}
+
+		defaults := &ConfigOptions{}
+		for _, f := range configFields {
+			if formatConfigValue(f.Value(data)) != formatConfigValue(f.Value(defaults)) {
+				data.Sources[f.Name] = SourceFile
+			}
+		}
 	}
 
-	logger.Info().Str("path", config.FullName).Msg("loading the asl config file")
+	if err := applyOverrides(data, flags, flagValues); err != nil {
+		return nil, err
+	}
 
-	data := &ConfigOptions{}
-	err := config.ReadJSON(data)
-	if err != nil {
+	if err := data.UsePortal(); err != nil {
 		return nil, err
 	}
 
-	data.BackupFile = opts.Backup
-	data.ForceSSOLogin = opts.ForceSSOLogin
+	if !config.Exists() && data.StartURL == "" {
+		return nil, errors.New("asl config file not found. please run: asl configure")
+	}
+
+	permissions = &PermissionPolicy{Keep: data.KeepPermissions, Force: data.ForceInsecure}
 
-	logger.Debug().Interface("data", data).Msg("the asl config file has been successfully read")
+	logger.Debug().Interface("data", data).Msg("the asl config has been successfully loaded")
 
 	return data, nil
 }
@@ -97,5 +514,6 @@ func init() {
 		logger.Fatal().Err(err)
 	}
 
-	aslPath = filepath.Join(home, ".asl")
+	aslPath = filepath.Join(configHome(home), "asl", "config")
+	legacyASLPath = filepath.Join(home, ".asl")
 }
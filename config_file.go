@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ConfigVersion is the current schema version of the asl config file
+	ConfigVersion = 1
+
+	// FormatJSON stores the asl config file as json
+	FormatJSON = "json"
+	// FormatYAML stores the asl config file as yaml
+	FormatYAML = "yaml"
+	// FormatTOML stores the asl config file as toml
+	FormatTOML = "toml"
+)
+
+// legacyASLPath is the config file used by older asl versions
+var legacyASLPath string
+
+// configExtensions defines the extensions accepted for the asl config file, a file
+// without extension is read as json or yaml and written as json
+var configExtensions = []string{"", ".yaml", ".yml", ".toml", ".json"}
+
+// ConfigFile returns the asl config file, the first existing file among the accepted
+// extensions is chosen, otherwise the file without extension is returned
+func ConfigFile() *File {
+	for _, ext := range configExtensions {
+		f := NewFile(aslPath + ext)
+		if f.Exists() {
+			return f
+		}
+	}
+
+	return NewFile(aslPath)
+}
+
+// configFormat returns the format of the asl config file based on its extension
+func configFormat(f *File) string {
+	switch strings.ToLower(f.Extension) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".toml":
+		return FormatTOML
+	default:
+		return FormatJSON
+	}
+}
+
+// ReadConfigFile reads the asl config file in any of the supported formats,
+// unknown fields are rejected so typos do not go unnoticed
+func ReadConfigFile(f *File, o *ConfigOptions) error {
+	b, err := f.Read()
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{}
+	switch {
+	case strings.ToLower(f.Extension) == ".toml":
+		err = toml.Unmarshal(b, &data)
+	case bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")):
+		err = json.Unmarshal(b, &data)
+	default:
+		err = yaml.Unmarshal(b, &data)
+	}
+	if err != nil {
+		return fmt.Errorf("the asl config file %s is malformed: %w", f.FullName, err)
+	}
+
+	j, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(j))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(o); err != nil {
+		return fmt.Errorf("the asl config file %s is invalid: %w", f.FullName, err)
+	}
+
+	return nil
+}
+
+// WriteConfigFile writes the asl config file in the given format
+func WriteConfigFile(f *File, o *ConfigOptions, format string) error {
+	if err := f.Create(); err != nil {
+		return err
+	}
+
+	if format == FormatJSON {
+		return f.WriteJSON(o)
+	}
+
+	j, err := json.Marshal(o)
+	if err != nil {
+		return err
+	}
+
+	data := map[string]interface{}{}
+	if err := json.Unmarshal(j, &data); err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	switch format {
+	case FormatYAML:
+		enc := yaml.NewEncoder(&b)
+		enc.SetIndent(2)
+		err = enc.Encode(data)
+	case FormatTOML:
+		err = toml.NewEncoder(&b).Encode(data)
+	default:
+		return fmt.Errorf("invalid config format %q, use [%s|%s|%s]", format, FormatJSON, FormatYAML, FormatTOML)
+	}
+	if err != nil {
+		return err
+	}
+
+	return f.WriteAtomic(b.Bytes())
+}
+
+// MigrateConfig moves the legacy config file to the current location and upgrades the schema
+// version, the legacy file is kept in the backup store. It returns nil when there is nothing to migrate.
+func MigrateConfig() (*File, error) {
+	legacy := NewFile(legacyASLPath)
+	if ConfigFile().Exists() || !legacy.Exists() {
+		return nil, nil
+	}
+
+	o := &ConfigOptions{}
+	if err := ReadConfigFile(legacy, o); err != nil {
+		return nil, err
+	}
+
+	if err := o.ValidateVersion(); err != nil {
+		return nil, err
+	}
+	o.Version = ConfigVersion
+
+	config := NewFile(aslPath)
+	if err := WriteConfigFile(config, o, FormatJSON); err != nil {
+		return nil, err
+	}
+
+	if _, err := NewBackupStore(o).Save(legacy); err != nil {
+		return nil, err
+	}
+
+	if err := os.Remove(legacy.FullName); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// configHome returns the XDG config directory
+func configHome(home string) string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
+	}
+
+	return filepath.Join(home, ".config")
+}
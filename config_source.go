@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	envPrefix = "ASL_"
+
+	// SourceDefault means the value has not been set
+	SourceDefault = "default"
+	// SourceFile means the value has been read from the asl config file
+	SourceFile = "file"
+	// SourceEnv means the value has been read from an environment variable
+	SourceEnv = "env"
+	// SourceFlag means the value has been read from a command line flag
+	SourceFlag = "flag"
+)
+
+// configField defines a ConfigOptions field that can be overridden by an environment variable
+// and a root flag. The value function returns a pointer to the field, allocating the parent when needed.
+type configField struct {
+	Name      string
+	Flag      string
+	Shorthand string
+	Usage     string
+	Default   string
+	Value     func(o *ConfigOptions) interface{}
+}
+
+// configFields lists all the ConfigOptions fields in the order they are displayed
+var configFields = []*configField{
+	{Name: "startUrl", Flag: "start-url", Usage: "the URL that points to the organization's AWS Single Sign-On (AWS SSO) user portal",
+		Value: func(o *ConfigOptions) interface{} { return &o.StartURL }},
+	{Name: "region", Flag: "region", Usage: "the AWS SSO region",
+		Value: func(o *ConfigOptions) interface{} { return &o.Region }},
+	{Name: "accountId", Flag: "account-id", Usage: "the AWS account used to log in to AWS SSO",
+		Value: func(o *ConfigOptions) interface{} { return &o.AccountID }},
+	{Name: "roleName", Flag: "role-name", Usage: "the role name used to log in to AWS SSO",
+		Value: func(o *ConfigOptions) interface{} { return &o.RoleName }},
+	{Name: "bootstrapProfile", Flag: "bootstrap-profile", Usage: "the profile written in the aws config file to log in to AWS SSO", Default: DefaultBootstrapProfile,
+		Value: func(o *ConfigOptions) interface{} { return &o.Bootstrap }},
+	{Name: "ssoProfiles", Flag: "sso-profiles", Usage: "write sso profiles to the aws config file instead of static credentials",
+		Value: func(o *ConfigOptions) interface{} { return &o.SSOProfiles }},
+	{Name: "ssoSession", Flag: "sso-session", Usage: "the sso-session referenced by the sso profiles", Default: DefaultSSOSession,
+		Value: func(o *ConfigOptions) interface{} { return &o.SSOSession }},
+	{Name: "secretStore", Flag: "secret-store", Usage: "keep the sso access token and the role credentials out of the aws files [file|secret-service|vault]",
+		Value: func(o *ConfigOptions) interface{} { return &o.SecretStore }},
+	{Name: "keepPermissions", Flag: "keep-permissions", Usage: "only warn about the files that other users can access instead of tightening their permissions",
+		Value: func(o *ConfigOptions) interface{} { return &o.KeepPermissions }},
+	{Name: "shortSessionMinutes", Flag: "short-session-minutes", Usage: "highlight the credentials that expire in less than these minutes", Default: "60",
+		Value: func(o *ConfigOptions) interface{} { return &o.ShortSession }},
+	{Name: "profiles.region", Flag: "profile-region", Usage: "the region of the profiles, defaults to the AWS SSO region",
+		Value: func(o *ConfigOptions) interface{} { return &o.profiles().Region }},
+	{Name: "profiles.keys", Flag: "profile-keys", Usage: "additional keys written to the profiles [key=value]",
+		Value: func(o *ConfigOptions) interface{} { return &o.profiles().Keys }},
+	{Name: "profiles.overrides", Flag: "profile-overrides", Usage: "region and keys by account and role as a json list",
+		Value: func(o *ConfigOptions) interface{} { return &o.profiles().Overrides }},
+	{Name: "chainedProfiles", Flag: "chained-profiles", Usage: "the profiles obtained by assuming a role with the credentials of a SSO account and role as a json list",
+		Value: func(o *ConfigOptions) interface{} { return &o.ChainedProfiles }},
+	{Name: "eks.include", Flag: "eks-include", Usage: "only add the eks clusters whose name matches the patterns",
+		Value: func(o *ConfigOptions) interface{} { return &o.eks().Include }},
+	{Name: "eks.exclude", Flag: "eks-exclude", Usage: "skip the eks clusters whose name matches the patterns",
+		Value: func(o *ConfigOptions) interface{} { return &o.eks().Exclude }},
+	{Name: "eks.profiles", Flag: "eks-profiles", Usage: "only look for eks clusters using the profiles that match the patterns",
+		Value: func(o *ConfigOptions) interface{} { return &o.eks().Profiles }},
+	{Name: "eks.roles", Flag: "eks-roles", Usage: "only look for eks clusters using the roles that match the patterns",
+		Value: func(o *ConfigOptions) interface{} { return &o.eks().Roles }},
+	{Name: "eks.tags", Flag: "eks-tags", Usage: "only add the eks clusters that have all the tags [key=value]",
+		Value: func(o *ConfigOptions) interface{} { return &o.eks().Tags }},
+	{Name: "backupRetention.count", Flag: "backup-retention-count", Usage: "the number of backups kept for each file, 0 keeps all",
+		Value: func(o *ConfigOptions) interface{} { return &o.backupRetention().Count }},
+	{Name: "backupRetention.maxAgeDays", Flag: "backup-retention-max-age-days", Usage: "the number of days the backups are kept, 0 keeps all",
+		Value: func(o *ConfigOptions) interface{} { return &o.backupRetention().MaxAgeDays }},
+	{Name: "portals", Flag: "portals", Usage: "the additional AWS SSO user portals as a json list",
+		Value: func(o *ConfigOptions) interface{} { return &o.Portals }},
+	{Name: "portal", Flag: "portal", Usage: "the name of the portal defined in the asl config file to log in to",
+		Value: func(o *ConfigOptions) interface{} { return &o.Portal }},
+	{Name: "backup", Flag: "backup", Shorthand: "b", Usage: "force a back up of the configuration files [.aws/config|.aws/credentials|kubeconfig], see: asl backup list",
+		Value: func(o *ConfigOptions) interface{} { return &o.BackupFile }},
+	{Name: "login", Flag: "login", Shorthand: "l", Usage: "force login to review the SSO access token",
+		Value: func(o *ConfigOptions) interface{} { return &o.ForceSSOLogin }},
+	{Name: "forceInsecurePermissions", Flag: "force-insecure-permissions", Usage: "write secrets to files that other users can access",
+		Value: func(o *ConfigOptions) interface{} { return &o.ForceInsecure }},
+	{Name: "eksSplit", Flag: "eks-split", Usage: "write one kubeconfig per account or profile in the kubeconfig-dir [account|profile]",
+		Value: func(o *ConfigOptions) interface{} { return &o.EKSSplit }},
+	{Name: "kubeconfig", Flag: "kubeconfig", Usage: "the kubeconfig file to update, defaults to the first path in KUBECONFIG or ~/.kube/config",
+		Value: func(o *ConfigOptions) interface{} { return &o.KubeConfig }},
+	{Name: "kubeconfigDir", Flag: "kubeconfig-dir", Usage: "the directory of the kubeconfig files written by --eks-split, defaults to ~/.kube/asl",
+		Value: func(o *ConfigOptions) interface{} { return &o.KubeConfigDir }},
+	{Name: "awsConfigFile", Flag: "aws-config-file", Usage: "the aws config file, defaults to AWS_CONFIG_FILE or ~/.aws/config",
+		Value: func(o *ConfigOptions) interface{} { return &o.AWSConfigFile }},
+	{Name: "awsCredentialsFile", Flag: "aws-credentials-file", Usage: "the aws credentials file, defaults to AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials",
+		Value: func(o *ConfigOptions) interface{} { return &o.AWSCredentialsFile }},
+	{Name: "ssoCacheDir", Flag: "sso-cache-dir", Usage: "the directory where asl reads the sso token cached by the aws cli, defaults to ~/.aws/sso/cache, it does not change where the aws cli writes it",
+		Value: func(o *ConfigOptions) interface{} { return &o.SSOCacheDir }},
+}
+
+// Env returns the environment variable that overrides the field, e.g. ASL_START_URL
+func (f *configField) Env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(f.Flag, "-", "_"))
+}
+
+// AddConfigFlags registers a flag for each ConfigOptions field, the flag values are stored in o
+func AddConfigFlags(flags *pflag.FlagSet, o *ConfigOptions) {
+	for _, f := range configFields {
+		usage := fmt.Sprintf("%s [%s]", f.Usage, f.Env())
+		switch v := f.Value(o).(type) {
+		case *string:
+			flags.StringVarP(v, f.Flag, f.Shorthand, "", usage)
+		case *bool:
+			flags.BoolVarP(v, f.Flag, f.Shorthand, false, usage)
+		case *int:
+			flags.IntVarP(v, f.Flag, f.Shorthand, 0, usage)
+		case *[]string:
+			flags.StringSliceVarP(v, f.Flag, f.Shorthand, nil, usage)
+		case *map[string]string:
+			flags.StringToStringVarP(v, f.Flag, f.Shorthand, nil, usage)
+		default:
+			flags.VarP(&jsonValue{v}, f.Flag, f.Shorthand, usage)
+		}
+	}
+}
+
+// applyOverrides sets the fields from the environment variables and then from the flags
+// that have been changed, the flag values are read from flagValues
+func applyOverrides(o *ConfigOptions, flags *pflag.FlagSet, flagValues *ConfigOptions) error {
+	for _, f := range configFields {
+		if env, ok := os.LookupEnv(f.Env()); ok {
+			if err := setConfigValue(f.Value(o), env); err != nil {
+				return fmt.Errorf("invalid value %q for %s: %w", env, f.Env(), err)
+			}
+			o.Sources[f.Name] = SourceEnv
+		}
+
+		if flags != nil && flags.Changed(f.Flag) {
+			copyConfigValue(f.Value(o), f.Value(flagValues))
+			o.Sources[f.Name] = SourceFlag
+		}
+	}
+
+	return nil
+}
+
+// Source returns where the field value comes from
+func (o *ConfigOptions) Source(name string) string {
+	if s, ok := o.Sources[name]; ok {
+		return s
+	}
+	return SourceDefault
+}
+
+// FieldValue returns the field value formatted to be displayed
+func (o *ConfigOptions) FieldValue(f *configField) string {
+	v := formatConfigValue(f.Value(o))
+	if v == "" && o.Source(f.Name) == SourceDefault {
+		return f.Default
+	}
+	return v
+}
+
+func (o *ConfigOptions) profiles() *ProfileOptions {
+	if o.Profiles == nil {
+		o.Profiles = &ProfileOptions{}
+	}
+	return o.Profiles
+}
+
+func (o *ConfigOptions) eks() *EKSFilter {
+	if o.EKS == nil {
+		o.EKS = &EKSFilter{}
+	}
+	return o.EKS
+}
+
+func (o *ConfigOptions) backupRetention() *BackupRetention {
+	if o.BackupRetention == nil {
+		o.BackupRetention = &BackupRetention{Count: defaultBackupKeep}
+	}
+	return o.BackupRetention
+}
+
+func setConfigValue(ptr interface{}, value string) error {
+	switch v := ptr.(type) {
+	case *string:
+		*v = value
+	case *bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		*v = b
+	case *int:
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*v = i
+	case *[]string:
+		*v = nil
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				*v = append(*v, s)
+			}
+		}
+	case *map[string]string:
+		m := map[string]string{}
+		for _, kv := range strings.Split(value, ",") {
+			if strings.TrimSpace(kv) == "" {
+				continue
+			}
+
+			p := strings.SplitN(kv, "=", 2)
+			if len(p) != 2 {
+				return fmt.Errorf("%q must be formatted as key=value", kv)
+			}
+			m[strings.TrimSpace(p[0])] = strings.TrimSpace(p[1])
+		}
+		*v = m
+	default:
+		return json.Unmarshal([]byte(value), ptr)
+	}
+
+	return nil
+}
+
+func copyConfigValue(dst, src interface{}) {
+	switch v := dst.(type) {
+	case *string:
+		*v = *src.(*string)
+	case *bool:
+		*v = *src.(*bool)
+	case *int:
+		*v = *src.(*int)
+	case *[]string:
+		*v = *src.(*[]string)
+	case *map[string]string:
+		*v = *src.(*map[string]string)
+	default:
+		b, _ := json.Marshal(src)
+		_ = json.Unmarshal(b, dst)
+	}
+}
+
+func formatConfigValue(ptr interface{}) string {
+	switch v := ptr.(type) {
+	case *string:
+		return *v
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *int:
+		return strconv.Itoa(*v)
+	case *[]string:
+		return strings.Join(*v, ",")
+	case *map[string]string:
+		var kv []string
+		for k, val := range *v {
+			kv = append(kv, k+"="+val)
+		}
+		sort.Strings(kv)
+		return strings.Join(kv, ",")
+	default:
+		b, _ := json.Marshal(ptr)
+		if s := string(b); s != "null" {
+			return s
+		}
+		return ""
+	}
+}
+
+// jsonValue implements pflag.Value for the fields set as json
+type jsonValue struct {
+	ptr interface{}
+}
+
+func (j *jsonValue) String() string {
+	return formatConfigValue(j.ptr)
+}
+
+func (j *jsonValue) Set(s string) error {
+	return json.Unmarshal([]byte(s), j.ptr)
+}
+
+func (j *jsonValue) Type() string {
+	return "json"
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func withASLPath(t *testing.T, content string) string {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config")
+	if content != "" {
+		_ = os.WriteFile(path, []byte(content), 0600)
+	}
+
+	oldPath, oldLegacy := aslPath, legacyASLPath
+	aslPath, legacyASLPath = path, filepath.Join(dir, ".asl")
+	t.Cleanup(func() { aslPath, legacyASLPath = oldPath, oldLegacy })
+	return path
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	withASLPath(t, `{"startUrl": "https://file.awsapps.com/start", "region": "us-east-1", "accountId": "123456789012", "eks": {"include": ["dev-*"]}}`)
+
+	t.Setenv("ASL_REGION", "sa-east-1")
+	t.Setenv("ASL_ACCOUNT_ID", "210987654321")
+	t.Setenv("ASL_EKS_TAGS", "team=platform, env=dev")
+	t.Setenv("ASL_BACKUP_RETENTION_COUNT", "3")
+
+	values := &ConfigOptions{}
+	flags := pflag.NewFlagSet("asl", pflag.ContinueOnError)
+	AddConfigFlags(flags, values)
+	require.Nil(t, flags.Parse([]string{"--account-id", "111111111111", "--backup"}))
+
+	cfg, err := LoadConfig(flags, values)
+	require.Nil(t, err)
+
+	require.Equal(t, "https://file.awsapps.com/start", cfg.StartURL)
+	require.Equal(t, "sa-east-1", cfg.Region)
+	require.Equal(t, "111111111111", cfg.AccountID)
+	require.True(t, cfg.BackupFile)
+	require.Equal(t, []string{"dev-*"}, cfg.EKS.Include)
+	require.Equal(t, map[string]string{"team": "platform", "env": "dev"}, cfg.EKS.Tags)
+	require.Equal(t, 3, cfg.BackupRetention.Count)
+
+	require.Equal(t, SourceFile, cfg.Source("startUrl"))
+	require.Equal(t, SourceEnv, cfg.Source("region"))
+	require.Equal(t, SourceFlag, cfg.Source("accountId"))
+	require.Equal(t, SourceFile, cfg.Source("eks.include"))
+	require.Equal(t, SourceDefault, cfg.Source("roleName"))
+}
+
+func TestLoadConfigWithoutFile(t *testing.T) {
+	withASLPath(t, "")
+
+	_, err := LoadConfig(nil, nil)
+	require.NotNil(t, err)
+
+	t.Setenv("ASL_START_URL", "https://env.awsapps.com/start")
+	t.Setenv("ASL_SSO_PROFILES", "foo")
+	_, err = LoadConfig(nil, nil)
+	require.EqualError(t, err, `invalid value "foo" for ASL_SSO_PROFILES: strconv.ParseBool: parsing "foo": invalid syntax`)
+
+	t.Setenv("ASL_SSO_PROFILES", "true")
+	cfg, err := LoadConfig(nil, nil)
+	require.Nil(t, err)
+	require.True(t, cfg.SSOProfiles)
+	require.Equal(t, DefaultBootstrapProfile, cfg.FieldValue(configFields[4]))
+}
+
+func TestReadConfigFileFormats(t *testing.T) {
+	path := withASLPath(t, "")
+
+	tests := map[string]string{
+		".yaml": "version: 1\nstartUrl: https://yaml.awsapps.com/start\nregion: us-east-1\neks:\n  include: [dev-*]\n",
+		".toml": "version = 1\nstartUrl = \"https://toml.awsapps.com/start\"\nregion = \"us-east-1\"\n[eks]\ninclude = [\"dev-*\"]\n",
+		".json": `{"version": 1, "startUrl": "https://json.awsapps.com/start", "region": "us-east-1", "eks": {"include": ["dev-*"]}}`,
+	}
+
+	for ext, content := range tests {
+		_ = os.WriteFile(path+ext, []byte(content), 0600)
+
+		f := ConfigFile()
+		require.Equal(t, path+ext, f.FullName)
+
+		o := &ConfigOptions{}
+		require.Nil(t, ReadConfigFile(f, o))
+		require.Equal(t, "https://"+ext[1:]+".awsapps.com/start", o.StartURL)
+		require.Equal(t, []string{"dev-*"}, o.EKS.Include)
+
+		_ = os.Remove(path + ext)
+	}
+}
+
+func TestReadConfigFileUnknownField(t *testing.T) {
+	withASLPath(t, "startUrl: https://foo.awsapps.com/start\nregoin: us-east-1\n")
+
+	err := ReadConfigFile(ConfigFile(), &ConfigOptions{})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), `unknown field "regoin"`)
+}
+
+func TestMigrateConfig(t *testing.T) {
+	path := withASLPath(t, "")
+	oldBackupPath := backupPath
+	backupPath = filepath.Join(t.TempDir(), "backups")
+	t.Cleanup(func() { backupPath = oldBackupPath })
+
+	_ = os.WriteFile(legacyASLPath, []byte(`{"startUrl": "https://foo.awsapps.com/start", "region": "us-east-1", "accountId": "123456789012", "roleName": "admin"}`), 0600)
+
+	f, err := MigrateConfig()
+	require.Nil(t, err)
+	require.Equal(t, path, f.FullName)
+	require.NoFileExists(t, legacyASLPath)
+
+	cfg, err := LoadConfig(nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, ConfigVersion, cfg.Version)
+	require.Equal(t, "https://foo.awsapps.com/start", cfg.StartURL)
+
+	backups, err := NewBackupStore(nil).List()
+	require.Nil(t, err)
+	require.Len(t, backups, 1)
+
+	f, err = MigrateConfig()
+	require.Nil(t, err)
+	require.Nil(t, f)
+}
+
+func TestLoadConfigNewerVersion(t *testing.T) {
+	withASLPath(t, `{"version": 99, "startUrl": "https://foo.awsapps.com/start"}`)
+
+	_, err := LoadConfig(nil, nil)
+	require.EqualError(t, err, "the asl config schema version 99 is newer than the supported version 1, please upgrade asl")
+}
+
+func TestConfigValidate(t *testing.T) {
+	o := &ConfigOptions{StartURL: "https://foo.awsapps.com/start", Region: "us-east-1", AccountID: "123456789012", RoleName: "admin"}
+	require.Nil(t, o.Validate())
+
+	o = &ConfigOptions{StartURL: "http://foo", Region: "useast1", AccountID: "1234", EKSSplit: "cluster"}
+	require.EqualError(t, o.Validate(), `invalid asl config:
+  - startUrl: "http://foo" is not a valid https URL, e.g. https://d-123456w78w.awsapps.com/start
+  - region: "useast1" is not a valid AWS region, e.g. us-east-1
+  - accountId: "1234" must have 12 digits
+  - roleName: is required
+  - eksSplit: "cluster" must be account or profile`)
+}
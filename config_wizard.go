@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	logger "github.com/rs/zerolog/log"
+)
+
+// Prompt asks questions and reads the answers line by line
+type Prompt struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewPrompt returns a new Prompt
+func NewPrompt(in io.Reader, out io.Writer) *Prompt {
+	return &Prompt{in: bufio.NewReader(in), out: out}
+}
+
+// Ask asks the question until the answer is valid, the default value is used when the answer is empty
+func (p *Prompt) Ask(question, def string, validate func(string) error) (string, error) {
+	for {
+		if def != "" {
+			fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+		} else {
+			fmt.Fprintf(p.out, "%s: ", question)
+		}
+
+		answer, err := p.readLine()
+		if err != nil {
+			return "", err
+		}
+
+		if answer == "" {
+			answer = def
+		}
+
+		if err := validate(answer); err != nil {
+			fmt.Fprintf(p.out, "%s %s\n", question, err)
+			continue
+		}
+
+		return answer, nil
+	}
+}
+
+// Choose lists the options and asks for one of them until the answer is valid, it returns the index of the chosen option
+func (p *Prompt) Choose(question string, options []string) (int, error) {
+	for i, o := range options {
+		fmt.Fprintf(p.out, "%3d) %s\n", i+1, o)
+	}
+
+	answer, err := p.Ask(question, "", func(v string) error {
+		if n, err := strconv.Atoi(v); err != nil || n < 1 || n > len(options) {
+			return fmt.Errorf("must be a number between 1 and %d", len(options))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n, _ := strconv.Atoi(answer)
+	return n - 1, nil
+}
+
+func (p *Prompt) readLine() (string, error) {
+	line, err := p.in.ReadString('\n')
+	if errors.Is(err, io.EOF) && line == "" {
+		return "", errors.New("no answer has been given, please run: asl configure --start-url <url> --region <region> --account-id <id> --role-name <name>")
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// ConfigureWizard asks for the start URL and region, logs in to AWS SSO and asks for the account and role
+// used to log in among the ones assigned to the user. The answers are stored in o.
+func ConfigureWizard(p *Prompt, cmd SSOCommand, o *ConfigOptions) error {
+	var err error
+
+	o.StartURL, err = p.Ask("AWS SSO start URL", o.StartURL, validateStartURL)
+	if err != nil {
+		return err
+	}
+
+	o.Region, err = p.Ask("AWS SSO region", o.Region, validateRegion)
+	if err != nil {
+		return err
+	}
+
+	// the bootstrap profile is written without account and role to log in and list the assignments
+	sso := NewSSO(cmd, &ConfigOptions{
+		StartURL:      o.StartURL,
+		Region:        o.Region,
+		Bootstrap:     o.Bootstrap,
+		SSOProfiles:   o.SSOProfiles,
+		SSOSession:    o.SSOSession,
+		ForceSSOLogin: o.ForceSSOLogin,
+		AWSConfigFile: o.AWSConfigFile,
+		SSOCacheDir:   o.SSOCacheDir,
+	})
+
+	if err := sso.PersistConfig(); err != nil {
+		return err
+	}
+
+	ssoCred, err := sso.Login()
+	if err != nil {
+		return err
+	}
+
+	accounts, err := sso.ListAccounts(ssoCred)
+	if err != nil {
+		return err
+	}
+
+	var options []string
+	var choices [][2]string
+	for _, acc := range accounts {
+		for _, r := range acc.Roles {
+			options = append(options, fmt.Sprintf("%s (%s) %s", acc.Name, acc.ID, r))
+			choices = append(choices, [2]string{acc.ID, r})
+		}
+	}
+
+	if len(choices) == 0 {
+		return fmt.Errorf("there are no accounts and roles assigned to the user in %s", o.StartURL)
+	}
+
+	i, err := p.Choose("Account and role used to log in", options)
+	if err != nil {
+		return err
+	}
+
+	o.AccountID, o.RoleName = choices[i][0], choices[i][1]
+
+	logger.Debug().Str("accountId", o.AccountID).Str("roleName", o.RoleName).Msg("account and role have been chosen")
+
+	return nil
+}
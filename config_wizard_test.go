@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigureWizard(t *testing.T) {
+	dir := withAWSPath(t)
+
+	startURL := "https://foo.awsapps.com/start"
+	hash := sha1.Sum([]byte(startURL))
+	cache := filepath.Join(dir, awsSSOPath, "cache", hex.EncodeToString(hash[:])+".json")
+	_ = os.MkdirAll(filepath.Dir(cache), 0750)
+	_ = os.WriteFile(cache, []byte(`{"startUrl": "`+startURL+`", "region": "us-east-1", "accessToken": "token", "expiresAt": "`+
+		time.Now().UTC().Add(time.Hour).Format("2006-01-02T15:04:05Z")+`"}`), 0600)
+
+	in := strings.NewReader("foo.awsapps.com\n" + startURL + "\n\nus-east-9\n5\n2\n")
+	var out bytes.Buffer
+
+	o := &ConfigOptions{Region: "us-east-1"}
+	err := ConfigureWizard(NewPrompt(in, &out), &SSOMock{}, o)
+	require.Nil(t, err)
+
+	require.Equal(t, startURL, o.StartURL)
+	require.Equal(t, "us-east-1", o.Region)
+	require.Equal(t, "123456789012", o.AccountID)
+	require.Equal(t, "ReadOnly", o.RoleName)
+
+	require.Contains(t, out.String(), `AWS SSO start URL "foo.awsapps.com" is not a valid https URL`)
+	require.Contains(t, out.String(), "  2) My Account (123456789012) ReadOnly\n")
+	require.Contains(t, out.String(), "must be a number between 1 and 3")
+
+	b, _ := os.ReadFile(filepath.Join(dir, "config"))
+	require.NotContains(t, string(b), keySSOAccountID)
+}
+
+func TestConfigureWizardWithoutAnswer(t *testing.T) {
+	withAWSPath(t)
+
+	err := ConfigureWizard(NewPrompt(strings.NewReader(""), &bytes.Buffer{}), &SSOMock{}, &ConfigOptions{})
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "no answer has been given")
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"time"
+
+	logger "github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultFederationEndpoint = "https://signin.aws.amazon.com/federation"
+	defaultConsoleService     = "console"
+	minConsoleDuration        = 15 * time.Minute
+	maxConsoleDuration        = 12 * time.Hour
+	consoleTimeout            = 30 * time.Second
+)
+
+// Console exchanges the role credentials for a sign-in token of the AWS federation endpoint
+// to build a URL that opens the AWS web console
+type Console struct {
+	Endpoint string
+	Client   *http.Client
+}
+
+// ConsoleOptions defines the page opened after the sign-in and the console session
+type ConsoleOptions struct {
+	Service  string
+	Region   string
+	Endpoint string
+	Duration time.Duration
+	Open     bool
+}
+
+// federationSession defines the credentials sent to the federation endpoint
+type federationSession struct {
+	SessionID    string `json:"sessionId"`
+	SessionKey   string `json:"sessionKey"`
+	SessionToken string `json:"sessionToken"`
+}
+
+// federationToken defines the structure returned by the federation endpoint
+type federationToken struct {
+	SigninToken string `json:"SigninToken"`
+}
+
+func consoleCmd(ctx context.Context) *cobra.Command {
+	o := &ConsoleOptions{}
+
+	cmd := &cobra.Command{
+		Use:   "console <profile>",
+		Short: "Print or open the AWS web console sign-in URL of a profile",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
+			if err != nil {
+				return err
+			}
+
+			// the startup context expires 30s after asl starts, the request has its own timeout
+			return o.Run(context.Background(), cfg, args[0])
+		},
+	}
+
+	cmd.Flags().StringVar(&o.Service, "service", defaultConsoleService, "the console service opened after the sign-in, e.g. ec2, s3, cloudwatch")
+	cmd.Flags().StringVar(&o.Region, "console-region", "", "the console region, defaults to the profile region")
+	cmd.Flags().DurationVar(&o.Duration, "duration", time.Hour, "the console session duration, between 15m and 12h")
+	cmd.Flags().BoolVar(&o.Open, "open", false, "open the URL in the default browser instead of printing it")
+	cmd.Flags().StringVar(&o.Endpoint, "federation-endpoint", defaultFederationEndpoint, "the AWS federation endpoint")
+
+	return cmd
+}
+
+// Run prints or opens the console sign-in URL of a profile
+func (o *ConsoleOptions) Run(ctx context.Context, cfg *ConfigOptions, profile string) error {
+	store, err := NewSecretStore(cfg)
+	if err != nil {
+		return err
+	}
+
+	cred, err := ReadProfileCredential(NewAWSFiles(cfg), store, profile)
+	if err != nil {
+		return err
+	}
+
+	region := o.Region
+	if region == "" {
+		region = cred.Region
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, consoleTimeout)
+	defer cancel()
+
+	c := &Console{Endpoint: o.Endpoint, Client: http.DefaultClient}
+	u, err := c.URL(ctx, cred, ConsoleDestination(o.Service, region), o.Duration)
+	if err != nil {
+		return err
+	}
+
+	if o.Open {
+		logger.Info().Str("profile", cred.ProfileName).Msg("opening the aws console in the browser...")
+		return openBrowser(u)
+	}
+
+	fmt.Println(u)
+	return nil
+}
+
+// ReadProfileCredential returns the credentials of a profile written by asl, from the aws
+// credentials file or from the secret store when the profile reads them through credential_process.
+// The credentials of the sso profiles are exported by the aws cli.
+func ReadProfileCredential(files *AWSFiles, store SecretStore, profile string) (*Credential, error) {
+	f := NewFile(files.Credentials)
+	f.Secret = true
+
+	b, err := f.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cfg := ParseIni(b)
+	if !cfg.HasSection(profile) {
+		return readSSOProfileCredential(files, profile)
+	}
+
+	c := &Credential{ProfileName: profile}
+	c.Region, _ = cfg.Get(profile, keyRegion)
+	c.AccessKeyID, _ = cfg.Get(profile, keyCrdAccessKeyID)
+	c.SecretAccessKey, _ = cfg.Get(profile, keyCrdSecretAccessKey)
+	c.SessionToken, _ = cfg.Get(profile, keyCrdSessionToken)
+
+	if c.AccessKeyID == "" {
+		if store == nil {
+			return nil, fmt.Errorf("the profile %s has no credentials, please run: asl", profile)
+		}
+
+		b, err := ReadCredentialProcess(store, profile)
+		if err != nil {
+			return nil, err
+		}
+
+		p := &CredentialProcess{}
+		if err := json.Unmarshal(b, p); err != nil {
+			return nil, err
+		}
+
+		c.AccessKeyID, c.SecretAccessKey, c.SessionToken = p.AccessKeyID, p.SecretAccessKey, p.SessionToken
+	}
+
+	if exp, ok := cfg.Get(profile, keyExpiration); ok {
+		if t, err := time.Parse(time.RFC3339, exp); err == nil {
+			if time.Now().After(t) {
+				return nil, fmt.Errorf("the credentials of the profile %s expired at %s, please run: asl", profile, formatExpiration(t))
+			}
+			c.Expiration = t.UnixNano() / int64(time.Millisecond)
+		}
+	}
+
+	return c, nil
+}
+
+// readSSOProfileCredential returns the credentials of a profile written with --sso-profiles, including
+// the chained ones, the aws cli retrieves them using the sso access token of its cache
+func readSSOProfileCredential(files *AWSFiles, profile string) (*Credential, error) {
+	b, err := NewFile(files.Config).Read()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cfg := ParseIni(b)
+	s := profileSection(profile)
+	_, session := cfg.Get(s, keySSOSession)
+	_, legacy := cfg.Get(s, keySSOUrl)
+	// the chained profiles written with --sso-profiles assume their role with a sso profile
+	_, chained := cfg.Get(s, keySourceProfile)
+	if !session && !legacy && !(chained && managed(cfg, s)) {
+		return nil, fmt.Errorf("the profile %s has not been found in the aws credentials file %s, please run: asl", profile, files.Credentials)
+	}
+
+	env, err := files.CliEnv(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Debug().Str("profile", profile).Msg("exporting the credentials of the sso profile...")
+
+	out, err := execCli(env, "configure", "export-credentials", "--profile", profile, "--format", "process")
+	if err != nil {
+		return nil, fmt.Errorf("exporting the credentials of the sso profile %s: %w", profile, err)
+	}
+
+	p := &CredentialProcess{}
+	if err := json.Unmarshal([]byte(out), p); err != nil {
+		return nil, fmt.Errorf("the aws cli returned invalid credentials for the sso profile %s: %w", profile, err)
+	}
+
+	c := &Credential{ProfileName: profile, AccessKeyID: p.AccessKeyID, SecretAccessKey: p.SecretAccessKey, SessionToken: p.SessionToken}
+	c.Region, _ = cfg.Get(s, keyRegion)
+	if t, err := time.Parse(time.RFC3339, p.Expiration); err == nil {
+		c.Expiration = t.UnixNano() / int64(time.Millisecond)
+	}
+
+	return c, nil
+}
+
+// ConsoleDestination returns the console URL of a service, the region is optional
+func ConsoleDestination(service, region string) string {
+	u := fmt.Sprintf("https://console.aws.amazon.com/%s/home", url.PathEscape(service))
+	if region != "" {
+		u += "?region=" + url.QueryEscape(region)
+	}
+	return u
+}
+
+// URL returns the sign-in URL that opens the destination, the duration is the console session duration
+func (c *Console) URL(ctx context.Context, cred *Credential, destination string, duration time.Duration) (string, error) {
+	token, err := c.SigninToken(ctx, cred, duration)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("Action", "login")
+	q.Set("Destination", destination)
+	q.Set("SigninToken", token)
+
+	return c.Endpoint + "?" + q.Encode(), nil
+}
+
+// SigninToken exchanges the credentials for a sign-in token, it is valid for 15 minutes
+func (c *Console) SigninToken(ctx context.Context, cred *Credential, duration time.Duration) (string, error) {
+	if duration < minConsoleDuration || duration > maxConsoleDuration {
+		return "", fmt.Errorf("the console session duration %s must be between %s and %s", duration, minConsoleDuration, maxConsoleDuration)
+	}
+
+	if cred.SessionToken == "" {
+		return "", fmt.Errorf("the credentials of the profile %s have no session token, the federation endpoint accepts only temporary credentials", cred.ProfileName)
+	}
+
+	session, err := json.Marshal(&federationSession{
+		SessionID:    cred.AccessKeyID,
+		SessionKey:   cred.SecretAccessKey,
+		SessionToken: cred.SessionToken,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("Action", "getSigninToken")
+	q.Set("SessionDuration", fmt.Sprintf("%d", int(duration.Seconds())))
+	q.Set("Session", string(session))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.Endpoint+"?"+q.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+
+	logger.Debug().Str("endpoint", c.Endpoint).Str("profile", cred.ProfileName).Msg("requesting the console sign-in token...")
+
+	res, err := c.Client.Do(req)
+	if err != nil {
+		// the request URL holds the credentials, only the cause is returned
+		var uerr *url.Error
+		if errors.As(err, &uerr) {
+			err = uerr.Err
+		}
+		return "", fmt.Errorf("requesting the sign-in token to %s: %w", c.Endpoint, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return "", err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("the federation endpoint %s returned %s, the credentials of the profile %s may have expired", c.Endpoint, res.Status, cred.ProfileName)
+	}
+
+	t := &federationToken{}
+	if err := json.Unmarshal(body, t); err != nil {
+		return "", fmt.Errorf("the federation endpoint %s returned an invalid response: %w", c.Endpoint, err)
+	}
+
+	if t.SigninToken == "" {
+		return "", fmt.Errorf("the federation endpoint %s returned no sign-in token", c.Endpoint)
+	}
+
+	return t.SigninToken, nil
+}
+
+// openBrowser opens the URL in the default browser
+func openBrowser(u string) error {
+	name := "xdg-open"
+	switch runtime.GOOS {
+	case "darwin":
+		name = "open"
+	case "windows":
+		return execCommand("rundll32", "url.dll,FileProtocolHandler", u).Start()
+	}
+
+	return execCommand(name, u).Start()
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsoleURL(t *testing.T) {
+	var query url.Values
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		_, _ = w.Write([]byte(`{"SigninToken": "signin-token"}`))
+	}))
+	defer srv.Close()
+
+	c := &Console{Endpoint: srv.URL, Client: srv.Client()}
+	cred := &Credential{ProfileName: "admin", AccessKeyID: "ASIA", SecretAccessKey: "secret-key", SessionToken: "session-token"}
+
+	u, err := c.URL(context.TODO(), cred, ConsoleDestination("ec2", "eu-west-1"), 2*time.Hour)
+	require.Nil(t, err)
+
+	require.Equal(t, "getSigninToken", query.Get("Action"))
+	require.Equal(t, "7200", query.Get("SessionDuration"))
+	session := &federationSession{}
+	require.Nil(t, json.Unmarshal([]byte(query.Get("Session")), session))
+	require.Equal(t, &federationSession{SessionID: "ASIA", SessionKey: "secret-key", SessionToken: "session-token"}, session)
+
+	login, err := url.Parse(u)
+	require.Nil(t, err)
+	require.Equal(t, srv.URL, login.Scheme+"://"+login.Host)
+	require.Equal(t, "login", login.Query().Get("Action"))
+	require.Equal(t, "signin-token", login.Query().Get("SigninToken"))
+	require.Equal(t, "https://console.aws.amazon.com/ec2/home?region=eu-west-1", login.Query().Get("Destination"))
+}
+
+func TestConsoleSigninTokenErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	c := &Console{Endpoint: srv.URL, Client: srv.Client()}
+	cred := &Credential{ProfileName: "admin", AccessKeyID: "ASIA", SecretAccessKey: "secret-key", SessionToken: "session-token"}
+
+	_, err := c.SigninToken(context.TODO(), cred, time.Hour)
+	require.EqualError(t, err, "the federation endpoint "+srv.URL+" returned 400 Bad Request, the credentials of the profile admin may have expired")
+
+	_, err = c.SigninToken(context.TODO(), cred, time.Minute)
+	require.EqualError(t, err, "the console session duration 1m0s must be between 15m0s and 12h0m0s")
+
+	cred.SessionToken = ""
+	_, err = c.SigninToken(context.TODO(), cred, time.Hour)
+	require.NotNil(t, err)
+}
+
+func TestReadProfileCredential(t *testing.T) {
+	dir := t.TempDir()
+	withPermissions(t, &PermissionPolicy{})
+	files := &AWSFiles{Credentials: filepath.Join(dir, "credentials")}
+	_ = os.WriteFile(files.Credentials, []byte(`[admin]
+region = us-east-1
+aws_expiration = 2030-01-01T10:00:00Z
+aws_access_key_id = ASIA
+aws_secret_access_key = secret-key
+aws_session_token = session-token
+
+[stored]
+region = eu-west-1
+credential_process = asl credential-process --secret-store file --profile stored
+
+[expired]
+aws_expiration = 2020-01-01T10:00:00Z
+aws_access_key_id = ASIA
+`), 0600)
+
+	c, err := ReadProfileCredential(files, nil, "admin")
+	require.Nil(t, err)
+	require.Equal(t, &Credential{ProfileName: "admin", Region: "us-east-1", AccessKeyID: "ASIA", SecretAccessKey: "secret-key",
+		SessionToken: "session-token", Expiration: 1893492000000}, c)
+
+	store := &FileStore{Dir: filepath.Join(dir, "secrets")}
+	require.Nil(t, store.Set(secretCredPrefix+"stored", []byte(`{"Version": 1, "AccessKeyId": "ASIASTORED", "SecretAccessKey": "stored-key", "SessionToken": "stored-token", "Expiration": "2030-01-01T10:00:00Z"}`)))
+
+	c, err = ReadProfileCredential(files, store, "stored")
+	require.Nil(t, err)
+	require.Equal(t, "eu-west-1", c.Region)
+	require.Equal(t, "ASIASTORED", c.AccessKeyID)
+
+	_, err = ReadProfileCredential(files, nil, "stored")
+	require.EqualError(t, err, "the profile stored has no credentials, please run: asl")
+
+	_, err = ReadProfileCredential(files, nil, "expired")
+	require.Contains(t, err.Error(), "the credentials of the profile expired expired at")
+
+	_, err = ReadProfileCredential(files, nil, "unknown")
+	require.Contains(t, err.Error(), "the profile unknown has not been found")
+}
+
+func TestReadProfileCredentialSSOProfile(t *testing.T) {
+	dir := t.TempDir()
+	withPermissions(t, &PermissionPolicy{})
+	files := &AWSFiles{Config: filepath.Join(dir, "config"), Credentials: filepath.Join(dir, "credentials")}
+	_ = os.WriteFile(files.Config, []byte(`[profile dev]
+region = eu-west-1
+sso_session = asl
+sso_account_id = 123456789012
+sso_role_name = Developer
+
+[profile static]
+region = us-east-1
+
+`+managedComment+`
+[profile deploy]
+role_arn = arn:aws:iam::999999999999:role/Deploy
+source_profile = dev
+region = us-east-1
+
+[profile mine]
+role_arn = arn:aws:iam::999999999999:role/Deploy
+source_profile = dev
+`), 0600)
+
+	var calls [][]string
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		calls = append(calls, append([]string{name}, args...))
+		return exec.Command("echo", `{"Version": 1, "AccessKeyId": "ASIASSO", "SecretAccessKey": "sso-key", "SessionToken": "sso-token", "Expiration": "2030-01-01T10:00:00Z"}`)
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+
+	c, err := ReadProfileCredential(files, nil, "dev")
+	require.Nil(t, err)
+	require.Equal(t, &Credential{ProfileName: "dev", Region: "eu-west-1", AccessKeyID: "ASIASSO", SecretAccessKey: "sso-key",
+		SessionToken: "sso-token", Expiration: 1893492000000}, c)
+	require.Equal(t, [][]string{{"aws", "configure", "export-credentials", "--profile", "dev", "--format", "process"}}, calls)
+
+	c, err = ReadProfileCredential(files, nil, "deploy")
+	require.Nil(t, err)
+	require.Equal(t, "us-east-1", c.Region)
+	require.Equal(t, "ASIASSO", c.AccessKeyID)
+	require.Equal(t, []string{"aws", "configure", "export-credentials", "--profile", "deploy", "--format", "process"}, calls[1])
+
+	_, err = ReadProfileCredential(files, nil, "static")
+	require.Contains(t, err.Error(), "the profile static has not been found")
+
+	_, err = ReadProfileCredential(files, nil, "mine")
+	require.Contains(t, err.Error(), "the profile mine has not been found")
+	require.Len(t, calls, 2)
+}
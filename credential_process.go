@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+const credentialProcessVersion = 1
+
+// CredentialProcess defines the output of the credential_process command read by the AWS SDKs
+type CredentialProcess struct {
+	Version         int    `json:"Version"`
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration"`
+}
+
+func credentialProcessCmd(ctx context.Context) *cobra.Command {
+	var profile string
+
+	cmd := &cobra.Command{
+		Use:   "credential-process",
+		Short: "Print the credentials of a profile kept in the secret store, it is called by the AWS SDKs through the credential_process setting",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// the AWS SDKs show the stderr of the credential process, only warnings and errors are logged
+			if !cmd.Flags().Changed("loglevel") {
+				zerolog.SetGlobalLevel(zerolog.WarnLevel)
+			}
+
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
+			if err != nil {
+				return err
+			}
+
+			store, err := NewSecretStore(cfg)
+			if err != nil {
+				return err
+			}
+
+			if store == nil {
+				return errors.New("no secret store has been configured, please run: asl --secret-store <file|secret-service|vault>")
+			}
+
+			b, err := ReadCredentialProcess(store, profile)
+			if err != nil {
+				return err
+			}
+
+			_, err = os.Stdout.Write(b)
+			return err
+		},
+	}
+
+	cmd.Flags().StringVar(&profile, "profile", "", "the profile whose credentials are printed")
+	_ = cmd.MarkFlagRequired("profile")
+
+	return cmd
+}
+
+// CredentialProcess returns the credentials in the credential_process format
+func (d *Credential) CredentialProcess() *CredentialProcess {
+	return &CredentialProcess{
+		Version:         credentialProcessVersion,
+		AccessKeyID:     d.AccessKeyID,
+		SecretAccessKey: d.SecretAccessKey,
+		SessionToken:    d.SessionToken,
+		Expiration:      d.ExpiresAt().UTC().Format(time.RFC3339),
+	}
+}
+
+// ReadCredentialProcess returns the credentials of a profile kept in the secret store, expired credentials are refused
+func ReadCredentialProcess(store SecretStore, profile string) ([]byte, error) {
+	b, err := store.Get(secretCredPrefix + profile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("no credentials have been found for the profile %s, please run: asl", profile)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c := &CredentialProcess{}
+	if err := json.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+
+	if exp, err := time.Parse(time.RFC3339, c.Expiration); err == nil && time.Now().After(exp) {
+		return nil, fmt.Errorf("the credentials of the profile %s expired at %s, please run: asl", profile, exp.Local().Format(time.RFC1123))
+	}
+
+	return b, nil
+}
+
+// credentialProcessCommand returns the command written to the credential_process setting of a profile
+func credentialProcessCommand(store, profile string) string {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = "asl"
+	}
+
+	if strings.ContainsAny(exe, " \t") {
+		exe = `"` + exe + `"`
+	}
+
+	return fmt.Sprintf("%s credential-process --secret-store %s --profile %s", exe, store, profile)
+}
@@ -2,25 +2,40 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
 	"text/template"
-	"time"
+
+	"github.com/mitchellh/go-homedir"
+	logger "github.com/rs/zerolog/log"
 )
 
 const (
-	filePerm os.FileMode = 0600
-	dirPerm  os.FileMode = 0750
+	filePerm    os.FileMode = 0600
+	dirPerm     os.FileMode = 0750
+	lockDirPerm os.FileMode = 0700
+
+	lockExtension = ".lock"
+	maxSymlinks   = 40
 )
 
+// lockPath is the private directory of the lock files, a sidecar next to the file would
+// collide with the locks of other tools, e.g. kubectl creates <kubeconfig>.lock exclusively
+var lockPath string
+
 // File represents the file options
 type File struct {
 	Filename  string
 	Path      string
 	FullName  string
 	Extension string
+	// Secret means the file holds credentials or tokens, see PermissionPolicy
+	Secret bool
 }
 
 // NewFile returns a new File
@@ -49,27 +64,12 @@ func (f *File) Create() error {
 	return nil
 }
 
-// Backup makes a copy of the file
-func (f *File) Backup() (string, error) {
-	if !f.Exists() {
-		return "", nil
-	}
-
-	bkpFilename := fmt.Sprintf("%s.backup_%d", f.FullName, time.Now().Unix())
-	b, err := os.ReadFile(f.FullName)
-	if err != nil {
-		return "", err
-	}
-
-	if err := os.WriteFile(bkpFilename, b, filePerm); err != nil {
-		return "", err
-	}
-
-	return bkpFilename, nil
-}
-
 // Read reads a file and returns the content as []byte
 func (f *File) Read() ([]byte, error) {
+	if err := permissions.Audit(f.FullName, f.Secret, false); err != nil {
+		return nil, err
+	}
+
 	b, err := os.ReadFile(f.FullName)
 	if err != nil {
 		return nil, err
@@ -80,7 +80,7 @@ func (f *File) Read() ([]byte, error) {
 
 // ReadString reads a file and returns the content as string
 func (f *File) ReadString() (string, error) {
-	b, err := os.ReadFile(f.FullName)
+	b, err := f.Read()
 	if err != nil {
 		return "", err
 	}
@@ -103,9 +103,201 @@ func (f *File) ReadJSON(s interface{}) error {
 	return nil
 }
 
+// Lock acquires an advisory exclusive lock for the file and returns the function to release it.
+// A separate lock file is used because the file itself is replaced by each atomic write, it is
+// kept in the lock directory, named after the resolved path, and removed when the lock is released.
+func (f *File) Lock() (func() error, error) {
+	if err := f.Create(); err != nil {
+		return nil, err
+	}
+
+	name, err := f.lockFile()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(lockPath, lockDirPerm); err != nil {
+		return nil, err
+	}
+
+	for {
+		lock, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, filePerm)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+			lock.Close()
+			return nil, fmt.Errorf("locking %s: %w", f.FullName, err)
+		}
+
+		// the holder removes the lock file when it releases the lock, so the lock
+		// is retried when the file has been removed or replaced while waiting
+		if !sameFile(lock, name) {
+			lock.Close()
+			continue
+		}
+
+		return func() error {
+			defer lock.Close()
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				logger.Warn().Err(err).Str("path", name).Msg("error removing the lock file")
+			}
+			return syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+		}, nil
+	}
+}
+
+// lockFile returns the lock file of the file, the links to the same file share the lock
+func (f *File) lockFile() (string, error) {
+	target, err := f.target()
+	if err != nil {
+		return "", err
+	}
+
+	target, err = filepath.Abs(target)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha1.Sum([]byte(target))
+	return filepath.Join(lockPath, hex.EncodeToString(sum[:])+lockExtension), nil
+}
+
+// sameFile returns if the opened file is still the one at the path
+func sameFile(f *os.File, path string) bool {
+	opened, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	current, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+
+	return os.SameFile(opened, current)
+}
+
+// target returns the path replaced by the atomic writes, the symbolic links are followed so
+// the links themselves are kept, e.g. dotfiles managers link ~/.aws/config to a repository.
+// A dangling link returns the path it points to.
+func (f *File) target() (string, error) {
+	p := f.FullName
+	for i := 0; i < maxSymlinks; i++ {
+		fi, err := os.Lstat(p)
+		if os.IsNotExist(err) {
+			return p, nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		if fi.Mode()&os.ModeSymlink == 0 {
+			return p, nil
+		}
+
+		link, err := os.Readlink(p)
+		if err != nil {
+			return "", err
+		}
+
+		if !filepath.IsAbs(link) {
+			link = filepath.Join(filepath.Dir(p), link)
+		}
+		p = link
+	}
+
+	return "", fmt.Errorf("too many levels of symbolic links: %s", f.FullName)
+}
+
+// WriteAtomic writes the content to a temporary file in the same directory and renames it
+// over the file, so readers see either the old or the new content but never a partial write.
+// When the file is a symbolic link, the file it points to is replaced and the link is kept.
+func (f *File) WriteAtomic(b []byte) error {
+	if err := permissions.Audit(f.FullName, f.Secret, true); err != nil {
+		return err
+	}
+
+	target, err := f.target()
+	if err != nil {
+		return err
+	}
+
+	perm := filePerm
+	if fi, err := os.Stat(target); err == nil {
+		perm = fi.Mode().Perm()
+	}
+
+	dir := filepath.Dir(target)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(target)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+// Update locks the file, passes its current content to fn and atomically writes the result.
+// The content is empty when the file does not exist.
+func (f *File) Update(fn func([]byte) ([]byte, error)) error {
+	unlock, err := f.Lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	b, err := f.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	b, err = fn(b)
+	if err != nil {
+		return err
+	}
+
+	return f.WriteAtomic(b)
+}
+
+// syncDir flushes the directory entry so a rename survives a crash
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
 // Write writes the string content in the file
 func (f *File) Write(content string) error {
-	return os.WriteFile(f.FullName, []byte(content), filePerm)
+	return f.WriteAtomic([]byte(content))
 }
 
 // WriteJSON writes the json in the file
@@ -115,7 +307,7 @@ func (f *File) WriteJSON(data interface{}) error {
 		return err
 	}
 
-	return os.WriteFile(f.FullName, b, filePerm)
+	return f.WriteAtomic(b)
 }
 
 // WriteTemplate writes the struct using a template
@@ -130,7 +322,7 @@ func (f *File) WriteTemplate(tmpl string, data interface{}) error {
 		return err
 	}
 
-	return os.WriteFile(f.FullName, b.Bytes(), filePerm)
+	return f.WriteAtomic(b.Bytes())
 }
 
 // WriteTemplateSlice writes a slice using a template
@@ -147,5 +339,25 @@ func (f *File) WriteTemplateSlice(tmpl string, data []interface{}) error {
 		}
 	}
 
-	return os.WriteFile(f.FullName, b.Bytes(), filePerm)
+	return f.WriteAtomic(b.Bytes())
+}
+
+func init() {
+	home, err := homedir.Dir()
+	if err != nil {
+		logger.Fatal().Err(err)
+	}
+
+	// the runtime directory is private to the user and cleared on logout
+	if runtime := os.Getenv("XDG_RUNTIME_DIR"); runtime != "" {
+		lockPath = filepath.Join(runtime, "asl", "locks")
+		return
+	}
+
+	state := os.Getenv("XDG_STATE_HOME")
+	if state == "" {
+		state = filepath.Join(home, ".local", "state")
+	}
+
+	lockPath = filepath.Join(state, "asl", "locks")
 }
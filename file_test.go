@@ -3,7 +3,8 @@ package main
 import (
 	"os"
 	"path/filepath"
-	"strings"
+	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,6 +20,19 @@ const (
 	tmpFilename = "go-test"
 )
 
+func TestMain(m *testing.M) {
+	// the lock files are kept out of the user state directory
+	dir, err := os.MkdirTemp("", "asl-locks")
+	if err != nil {
+		panic(err)
+	}
+	lockPath = dir
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 func createTempFile(data []byte) ([]string, func()) {
 	f, _ := os.CreateTemp(tmpDir, tmpFilename)
 	_, _ = f.Write(data)
@@ -121,15 +135,92 @@ func TestWriteTemplateSliceInFile(t *testing.T) {
 	require.Equal(t, "id: 1\nname: fooid: 2\nname: bar", string(b))
 }
 
-func TestBackupFile(t *testing.T) {
-	filename := "/tmp/go-test-bkp"
-	_ = os.WriteFile(filename, []byte("foo"), 0644)
+func TestWriteAtomicKeepsPermissions(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	_ = os.WriteFile(filename, []byte("foo"), 0640)
 
 	f := NewFile(filename)
-	bkp, _ := f.Backup()
-
-	require.True(t, strings.HasPrefix(bkp, filename))
+	err := f.WriteAtomic([]byte("bar"))
+	require.Nil(t, err)
 
 	b, _ := os.ReadFile(filename)
-	require.Equal(t, "foo", string(b))
+	require.Equal(t, "bar", string(b))
+
+	fi, _ := os.Stat(filename)
+	require.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+
+	entries, _ := os.ReadDir(f.Path)
+	require.Len(t, entries, 1)
+}
+
+func TestLockRemovesTheLockFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "config")
+	f := NewFile(filename)
+
+	err := f.Update(func(b []byte) ([]byte, error) {
+		// kubectl locks a kubeconfig by creating <kubeconfig>.lock exclusively
+		lock, err := os.OpenFile(filename+".lock", os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		lock.Close()
+		return []byte("foo"), os.Remove(filename + ".lock")
+	})
+	require.Nil(t, err)
+
+	entries, _ := os.ReadDir(f.Path)
+	require.Len(t, entries, 1)
+
+	locks, _ := os.ReadDir(lockPath)
+	require.Len(t, locks, 0)
+}
+
+func TestWriteAtomicKeepsSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "config")
+	link := filepath.Join(dir, "config")
+	_ = os.MkdirAll(filepath.Dir(target), 0700)
+	_ = os.WriteFile(target, []byte("foo"), 0600)
+	_ = os.Symlink(filepath.Join("dotfiles", "config"), link)
+
+	err := NewFile(link).Update(func([]byte) ([]byte, error) {
+		return []byte("bar"), nil
+	})
+	require.Nil(t, err)
+
+	fi, _ := os.Lstat(link)
+	require.NotZero(t, fi.Mode()&os.ModeSymlink)
+
+	b, _ := os.ReadFile(target)
+	require.Equal(t, "bar", string(b))
+
+	dangling := filepath.Join(dir, "credentials")
+	_ = os.Symlink(filepath.Join(dir, "dotfiles", "credentials"), dangling)
+	require.Nil(t, NewFile(dangling).Write("baz"))
+
+	fi, _ = os.Lstat(dangling)
+	require.NotZero(t, fi.Mode()&os.ModeSymlink)
+	b, _ = os.ReadFile(filepath.Join(dir, "dotfiles", "credentials"))
+	require.Equal(t, "baz", string(b))
+}
+
+func TestUpdateFileConcurrently(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "counter")
+	f := NewFile(filename)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = NewFile(filename).Update(func(b []byte) ([]byte, error) {
+				n, _ := strconv.Atoi(string(b))
+				return []byte(strconv.Itoa(n + 1)), nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	res, _ := f.ReadString()
+	require.Equal(t, "20", res)
 }
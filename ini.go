@@ -0,0 +1,278 @@
+package main
+
+import (
+	"strings"
+)
+
+// IniFile edits ini content surgically: only the changed keys and sections are rewritten,
+// comments, blank lines, key order and the other sections are kept byte-for-byte identical
+type IniFile struct {
+	lines   []string
+	newline string
+	eol     bool
+}
+
+// ParseIni returns a new IniFile
+func ParseIni(b []byte) *IniFile {
+	content := string(b)
+
+	newline := "\n"
+	if strings.Contains(content, "\r\n") {
+		newline = "\r\n"
+	}
+
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, newline), newline)
+	}
+
+	return &IniFile{
+		lines:   lines,
+		newline: newline,
+		eol:     content == "" || strings.HasSuffix(content, newline),
+	}
+}
+
+// Bytes returns the ini content
+func (f *IniFile) Bytes() []byte {
+	if len(f.lines) == 0 {
+		return nil
+	}
+
+	content := strings.Join(f.lines, f.newline)
+	if f.eol {
+		content += f.newline
+	}
+
+	return []byte(content)
+}
+
+// Sections returns the section names in the order they appear
+func (f *IniFile) Sections() []string {
+	var names []string
+	for _, l := range f.lines {
+		if name, ok := iniSectionName(l); ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// HasSection returns if the section exists
+func (f *IniFile) HasSection(section string) bool {
+	start, _ := f.section(section)
+	return start >= 0
+}
+
+// Keys returns the keys of a section in the order they appear
+func (f *IniFile) Keys(section string) []string {
+	start, end := f.section(section)
+	if start < 0 {
+		return nil
+	}
+
+	var keys []string
+	for i := start + 1; i < end; i++ {
+		if key, _, ok := iniKeyValue(f.lines[i]); ok {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Get returns the value of a key in a section
+func (f *IniFile) Get(section, key string) (string, bool) {
+	i := f.key(section, key)
+	if i < 0 {
+		return "", false
+	}
+
+	_, v, _ := iniKeyValue(f.lines[i])
+	return v, true
+}
+
+// Comments returns the comment lines right above the section header
+func (f *IniFile) Comments(section string) []string {
+	start, _ := f.section(section)
+	if start < 0 {
+		return nil
+	}
+
+	var comments []string
+	for i := start - 1; i >= 0; i-- {
+		l := strings.TrimSpace(f.lines[i])
+		if !iniComment(l) {
+			break
+		}
+		comments = append([]string{l}, comments...)
+	}
+	return comments
+}
+
+// AddSection appends an empty section preceded by a comment line when it does not exist
+func (f *IniFile) AddSection(section, comment string) {
+	if f.HasSection(section) {
+		return
+	}
+
+	if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+		f.lines = append(f.lines, "")
+	}
+
+	if comment != "" {
+		f.lines = append(f.lines, comment)
+	}
+
+	f.lines = append(f.lines, "["+section+"]")
+}
+
+// Set changes the value of a key keeping its position and the spacing around the equal sign,
+// a new key is added after the last key of the section and a new section at the end of the file
+func (f *IniFile) Set(section, key, value string) {
+	if i := f.key(section, key); i >= 0 {
+		l := f.lines[i]
+		eq := strings.Index(l, "=")
+		prefix := l[:eq+1]
+		rest := l[eq+1:]
+		spaces := rest[:len(rest)-len(strings.TrimLeft(rest, " \t"))]
+		if spaces == "" && strings.HasSuffix(strings.TrimRight(prefix, "="), " ") {
+			spaces = " "
+		}
+		f.lines[i] = prefix + spaces + value
+		return
+	}
+
+	line := key + " = " + value
+
+	start, end := f.section(section)
+	if start < 0 {
+		if len(f.lines) > 0 && strings.TrimSpace(f.lines[len(f.lines)-1]) != "" {
+			f.lines = append(f.lines, "")
+		}
+		f.lines = append(f.lines, "["+section+"]", line)
+		return
+	}
+
+	f.insert(f.lastContent(start, end)+1, line)
+}
+
+// DeleteKey removes a key and its nested lines from a section
+func (f *IniFile) DeleteKey(section, key string) {
+	i := f.key(section, key)
+	if i < 0 {
+		return
+	}
+
+	j := i + 1
+	for j < len(f.lines) && iniNested(f.lines[j]) {
+		j++
+	}
+
+	f.lines = append(f.lines[:i], f.lines[j:]...)
+}
+
+// DeleteSection removes a section and the comments right above it,
+// the comments and blank lines before the next section are kept
+func (f *IniFile) DeleteSection(section string) {
+	start, end := f.section(section)
+	if start < 0 {
+		return
+	}
+
+	comments := len(f.Comments(section))
+	start -= comments
+
+	last := f.lastContent(start+comments, end)
+	f.lines = append(f.lines[:start], f.lines[last+1:]...)
+
+	// avoid leaving two blank lines where the section was
+	blank := func(i int) bool { return i < 0 || i >= len(f.lines) || strings.TrimSpace(f.lines[i]) == "" }
+	if start < len(f.lines) && blank(start) && blank(start-1) {
+		f.lines = append(f.lines[:start], f.lines[start+1:]...)
+	}
+}
+
+// section returns the index of the section header and the index where the section ends
+func (f *IniFile) section(section string) (int, int) {
+	start := -1
+	for i, l := range f.lines {
+		name, ok := iniSectionName(l)
+		if !ok {
+			continue
+		}
+
+		if start >= 0 {
+			return start, i
+		}
+
+		if name == section {
+			start = i
+		}
+	}
+
+	if start < 0 {
+		return -1, -1
+	}
+
+	return start, len(f.lines)
+}
+
+// key returns the index of a key in a section
+func (f *IniFile) key(section, key string) int {
+	start, end := f.section(section)
+	for i := start + 1; start >= 0 && i < end; i++ {
+		if k, _, ok := iniKeyValue(f.lines[i]); ok && k == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// lastContent returns the index of the last line of a section that is neither blank nor a comment
+func (f *IniFile) lastContent(start, end int) int {
+	last := start
+	for i := start + 1; i < end; i++ {
+		l := strings.TrimSpace(f.lines[i])
+		if l != "" && !iniComment(l) {
+			last = i
+		}
+	}
+	return last
+}
+
+func (f *IniFile) insert(i int, line string) {
+	f.lines = append(f.lines, "")
+	copy(f.lines[i+1:], f.lines[i:])
+	f.lines[i] = line
+}
+
+func iniSectionName(line string) (string, bool) {
+	l := strings.TrimSpace(line)
+	if !strings.HasPrefix(l, "[") || !strings.HasSuffix(l, "]") {
+		return "", false
+	}
+
+	return strings.TrimSpace(l[1 : len(l)-1]), true
+}
+
+func iniKeyValue(line string) (string, string, bool) {
+	if iniNested(line) || iniComment(strings.TrimSpace(line)) {
+		return "", "", false
+	}
+
+	i := strings.Index(line, "=")
+	if i < 0 {
+		return "", "", false
+	}
+
+	return strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:]), true
+}
+
+// iniNested returns if the line is indented, it belongs to the previous key (e.g. s3 settings)
+func iniNested(line string) bool {
+	return strings.TrimSpace(line) != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"))
+}
+
+func iniComment(line string) bool {
+	return strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";")
+}
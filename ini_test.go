@@ -0,0 +1,119 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const iniContent = `# my aws credentials
+[default]
+aws_access_key_id=foo
+aws_secret_access_key   =   bar
+
+; legacy account, do not remove
+[legacy]
+region = sa-east-1
+s3 =
+    max_concurrent_requests = 20
+  
+# the next section is managed by asl
+[dev]
+output = json
+aws_access_key_id = old
+`
+
+func TestIniRoundTrip(t *testing.T) {
+	for _, content := range []string{
+		iniContent,
+		"",
+		"\n",
+		"[default]\nregion = us-east-1",
+		"[default]\r\nregion = us-east-1\r\n\r\n[dev]\r\n",
+	} {
+		require.Equal(t, content, string(ParseIni([]byte(content)).Bytes()))
+	}
+}
+
+func TestIniGet(t *testing.T) {
+	f := ParseIni([]byte(iniContent))
+
+	require.Equal(t, []string{"default", "legacy", "dev"}, f.Sections())
+	require.Equal(t, []string{"region", "s3"}, f.Keys("legacy"))
+
+	v, ok := f.Get("default", "aws_secret_access_key")
+	require.True(t, ok)
+	require.Equal(t, "bar", v)
+
+	_, ok = f.Get("legacy", "max_concurrent_requests")
+	require.False(t, ok)
+
+	_, ok = f.Get("foo", "region")
+	require.False(t, ok)
+}
+
+func TestIniSetKeepsFormatting(t *testing.T) {
+	f := ParseIni([]byte(iniContent))
+	f.Set("default", "aws_secret_access_key", "baz")
+	f.Set("default", "aws_access_key_id", "qux")
+	f.Set("legacy", "output", "text")
+	f.Set("dev", "aws_access_key_id", "new")
+	f.Set("dev", "region", "us-east-1")
+	f.Set("prod", "region", "eu-west-1")
+
+	require.Equal(t, `# my aws credentials
+[default]
+aws_access_key_id=qux
+aws_secret_access_key   =   baz
+
+; legacy account, do not remove
+[legacy]
+region = sa-east-1
+s3 =
+    max_concurrent_requests = 20
+output = text
+  
+# the next section is managed by asl
+[dev]
+output = json
+aws_access_key_id = new
+region = us-east-1
+
+[prod]
+region = eu-west-1
+`, string(f.Bytes()))
+}
+
+func TestIniSetKeepsLineEndings(t *testing.T) {
+	f := ParseIni([]byte("[dev]\r\nregion = us-east-1\r\n"))
+	f.Set("dev", "output", "json")
+	require.Equal(t, "[dev]\r\nregion = us-east-1\r\noutput = json\r\n", string(f.Bytes()))
+}
+
+func TestIniDelete(t *testing.T) {
+	f := ParseIni([]byte(iniContent))
+	f.DeleteKey("legacy", "s3")
+	f.DeleteSection("default")
+
+	require.Equal(t, `; legacy account, do not remove
+[legacy]
+region = sa-east-1
+  
+# the next section is managed by asl
+[dev]
+output = json
+aws_access_key_id = old
+`, string(f.Bytes()))
+}
+
+func TestIniSectionComments(t *testing.T) {
+	f := ParseIni([]byte(iniContent))
+	require.Equal(t, []string{"# the next section is managed by asl"}, f.Comments("dev"))
+	require.Nil(t, f.Comments("foo"))
+
+	f.AddSection("prod", "# managed")
+	f.AddSection("dev", "# managed")
+	f.Set("prod", "region", "eu-west-1")
+	require.Equal(t, []string{"# managed"}, f.Comments("prod"))
+	require.Equal(t, iniContent+"\n# managed\n[prod]\nregion = eu-west-1\n", string(f.Bytes()))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// ListTable prints the accounts and roles as an aligned table
+	ListTable = "table"
+	// ListJSON prints the accounts and their roles as a JSON array
+	ListJSON = "json"
+	// ListCSV prints a row for each account and role
+	ListCSV = "csv"
+)
+
+// ListFilter defines the accounts and roles listed, the account matches by ID or name
+// and all patterns use the shell file name pattern syntax
+type ListFilter struct {
+	Accounts []string
+	Roles    []string
+}
+
+// ListAccount defines an account and its roles printed by asl list
+type ListAccount struct {
+	ID    string      `json:"accountId"`
+	Name  string      `json:"accountName"`
+	Email string      `json:"emailAddress"`
+	Roles []*ListRole `json:"roles"`
+}
+
+// ListRole defines a role printed by asl list, the profile is the one asl writes for it
+type ListRole struct {
+	Name    string `json:"roleName"`
+	Profile string `json:"profile,omitempty"`
+}
+
+func listCmd(ctx context.Context) *cobra.Command {
+	var output string
+	var showProfiles bool
+	filter := &ListFilter{}
+
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the accounts and roles assigned to the user, no credentials are retrieved and no file is written",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if output != ListTable && output != ListJSON && output != ListCSV {
+				return fmt.Errorf("invalid output %q, use [%s|%s|%s]", output, ListTable, ListJSON, ListCSV)
+			}
+
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
+			if err != nil {
+				return err
+			}
+
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			accounts, profiles, err := ListProfiles(cfg)
+			if err != nil {
+				return err
+			}
+
+			return WriteList(os.Stdout, output, filter.Apply(accounts, profiles, showProfiles))
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", ListTable, "print the accounts and roles as [table|json|csv]")
+	cmd.Flags().BoolVar(&showProfiles, "show-profiles", false, "show the profile name asl writes for each account and role")
+	cmd.Flags().StringSliceVar(&filter.Accounts, "account", nil, "list only the accounts whose ID or name match the patterns")
+	cmd.Flags().StringSliceVar(&filter.Roles, "role", nil, "list only the roles that match the patterns")
+
+	return cmd
+}
+
+// ListProfiles lists the accounts assigned to the user and the profile of each role. The aws
+// config file is written to a sandbox, because the login needs the bootstrap profile, so
+// no file is changed and GetRoleCredentials is never called.
+func ListProfiles(cfg *ConfigOptions) ([]*Account, []*Credential, error) {
+	sandbox, err := NewSandbox()
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sandbox.Close()
+
+	env, err := NewAWSFiles(cfg).CliEnv(sandbox)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sso := NewSSO(&SSOCli{Env: env}, cfg)
+	sso.Sandbox = sandbox
+	sso.Secrets, err = NewSecretStore(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := sso.PersistConfig(); err != nil {
+		return nil, nil, err
+	}
+
+	ssoCred, err := sso.Login()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accounts, err := sso.ListAccounts(ssoCred)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return accounts, sso.Profiles(ssoCred, accounts), nil
+}
+
+// Allow returns if a profile must be listed
+func (f *ListFilter) Allow(p *Credential) bool {
+	if len(f.Accounts) > 0 && !MatchAny(f.Accounts, p.AccountID) && !MatchAny(f.Accounts, p.AccountName) {
+		return false
+	}
+
+	return len(f.Roles) == 0 || MatchAny(f.Roles, p.RoleName)
+}
+
+// Apply groups the allowed profiles by account, the accounts without any allowed role are left out
+func (f *ListFilter) Apply(accounts []*Account, profiles []*Credential, showProfiles bool) []*ListAccount {
+	var list []*ListAccount
+	for _, acc := range accounts {
+		la := &ListAccount{ID: acc.ID, Name: acc.Name, Email: acc.Email}
+		for _, p := range profiles {
+			if p.AccountID != acc.ID || !f.Allow(p) {
+				continue
+			}
+
+			r := &ListRole{Name: p.RoleName}
+			if showProfiles {
+				r.Profile = p.ProfileName
+			}
+			la.Roles = append(la.Roles, r)
+		}
+
+		if len(la.Roles) > 0 {
+			list = append(list, la)
+		}
+	}
+
+	return list
+}
+
+// WriteList prints the accounts and roles in the given format, the profile
+// column is printed only when the profiles are shown
+func WriteList(w io.Writer, format string, accounts []*ListAccount) error {
+	if format == ListJSON {
+		if accounts == nil {
+			accounts = []*ListAccount{}
+		}
+
+		b, err := json.MarshalIndent(accounts, "", " ")
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+
+	showProfiles := false
+	for _, acc := range accounts {
+		for _, r := range acc.Roles {
+			showProfiles = showProfiles || r.Profile != ""
+		}
+	}
+
+	// the csv header uses the json field names
+	header := []string{"ACCOUNT ID", "ACCOUNT NAME", "EMAIL", "ROLE", "PROFILE"}
+	if format == ListCSV {
+		header = []string{"accountId", "accountName", "emailAddress", "roleName", "profile"}
+	}
+	if !showProfiles {
+		header = header[:len(header)-1]
+	}
+
+	var rows [][]string
+	for _, acc := range accounts {
+		for _, r := range acc.Roles {
+			row := []string{acc.ID, acc.Name, acc.Email, r.Name}
+			if showProfiles {
+				row = append(row, r.Profile)
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	if format == ListCSV {
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return err
+		}
+		if err := cw.WriteAll(rows); err != nil {
+			return err
+		}
+		return cw.Error()
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func listAccounts() []*ListAccount {
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{})
+	accounts := []*Account{
+		{ID: "123456789012", Name: "My Account", Email: "me@example.com", Roles: []string{"AdministratorAccess", "ReadOnly"}},
+		{ID: "210987654321", Name: "Mine", Email: "mine@example.com", Roles: []string{"ReadOnly"}},
+	}
+	profiles := sso.Profiles(&SSOCredential{Region: "us-east-1"}, accounts)
+
+	f := &ListFilter{Accounts: []string{"My *"}, Roles: []string{"Admin*"}}
+	return f.Apply(accounts, profiles, true)
+}
+
+func TestListFilter(t *testing.T) {
+	require.Equal(t, []*ListAccount{
+		{ID: "123456789012", Name: "My Account", Email: "me@example.com", Roles: []*ListRole{{Name: "AdministratorAccess", Profile: "my-account"}}},
+	}, listAccounts())
+
+	f := &ListFilter{Accounts: []string{"210987654321"}}
+	require.True(t, f.Allow(&Credential{AccountID: "210987654321", RoleName: "ReadOnly"}))
+	require.False(t, f.Allow(&Credential{AccountID: "123456789012", AccountName: "My Account"}))
+}
+
+func TestWriteList(t *testing.T) {
+	var b bytes.Buffer
+	require.Nil(t, WriteList(&b, ListTable, listAccounts()))
+	require.Equal(t, `ACCOUNT ID     ACCOUNT NAME   EMAIL            ROLE                  PROFILE
+123456789012   My Account     me@example.com   AdministratorAccess   my-account
+`, b.String())
+
+	b.Reset()
+	require.Nil(t, WriteList(&b, ListCSV, listAccounts()))
+	require.Equal(t, `accountId,accountName,emailAddress,roleName,profile
+123456789012,My Account,me@example.com,AdministratorAccess,my-account
+`, b.String())
+
+	b.Reset()
+	require.Nil(t, WriteList(&b, ListJSON, nil))
+	require.Equal(t, "[]\n", b.String())
+
+	b.Reset()
+	accounts := listAccounts()
+	accounts[0].Roles[0].Profile = ""
+	require.Nil(t, WriteList(&b, ListCSV, accounts))
+	require.Equal(t, `accountId,accountName,emailAddress,roleName
+123456789012,My Account,me@example.com,AdministratorAccess
+`, b.String())
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"time"
 
@@ -13,9 +14,9 @@ import (
 
 // Options defines root command options
 type Options struct {
-	Backup        bool
-	EKS           bool
-	ForceSSOLogin bool
+	EKS    bool
+	DryRun bool
+	Output string
 }
 
 var (
@@ -27,6 +28,8 @@ var (
 	GitHash = ""
 
 	opts = &Options{}
+	// flagConfig holds the values of the flags that override the asl config file
+	flagConfig = &ConfigOptions{}
 )
 
 const (
@@ -35,17 +38,29 @@ const (
 *****************************************************************************************************************
 %s
 %s
-note that it will expire at %s
+%s
 after this time, you may safely rerun this cli to refresh your credentials
 *****************************************************************************************************************
 `
 	ssoMsgTmpl = `SSO
    your new access key pair has been stored in the aws configuration file %s
    to use these credentials, set the AWS_PROFILE or call the aws cli with the --profile option.
+`
+	ssoSecretsMsgTmpl = `SSO
+   your new access key pair has been stored in the %s secret store
+   the profiles of the aws configuration file %s read it through credential_process, set the AWS_PROFILE or call the aws cli with the --profile option.
+`
+	ssoProfilesMsgTmpl = `SSO
+   your sso profiles have been stored in the aws configuration file %s
+   the aws cli and sdks refresh these credentials through the sso-session %s, set the AWS_PROFILE or call the aws cli with the --profile option.
 `
 	eksMsgTmpl = `EKS
    your kubernetes config has been updated in the kubeconfig file %s
    to use these contexts, run kubectl config set-context <name> or call the kubectl with the --context option
+`
+	eksSplitMsgTmpl = `EKS
+   your kubernetes config has been split into %d kubeconfig files in the directory %s
+   to use these contexts, run: export KUBECONFIG=$(cat %s)
 `
 )
 
@@ -54,62 +69,162 @@ func main() {
 		Use:   "asl",
 		Short: "Get credentials for all accounts for which you have permission in AWS SSO",
 		Long:  ``,
-		RunE: func(cmd *cobra.Command, args []string) error {
-			cfg, err := LoadConfig(opts)
+		RunE: func(cmd *cobra.Command, args []string) (err error) {
+			var report *Report
+			switch opts.Output {
+			case OutputText:
+			case OutputJSON:
+				// the logs keep going to stderr, so stdout holds only the report
+				report = NewReport()
+				report.DryRun = opts.DryRun
+				defer func() {
+					if err != nil {
+						report.Error = err.Error()
+					}
+					if werr := report.Write(os.Stdout); werr != nil && err == nil {
+						err = werr
+					}
+				}()
+			default:
+				return fmt.Errorf("invalid output %q, use [%s|%s]", opts.Output, OutputText, OutputJSON)
+			}
+
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
 			if err != nil {
 				return err
 			}
 
-			sso := NewSSO(&SSOCli{}, cfg)
-			err = sso.PersistConfig()
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			var sandbox *Sandbox
+			if opts.DryRun {
+				sandbox, err = NewSandbox()
+				if err != nil {
+					return err
+				}
+				defer sandbox.Close()
+			}
+
+			env, err := NewAWSFiles(cfg).CliEnv(sandbox)
 			if err != nil {
 				return err
 			}
 
-			ssoCred, err := sso.Login()
+			sso := NewSSO(&SSOCli{Env: env}, cfg)
+			sso.Sandbox = sandbox
+			sso.Report = report
+			sso.Secrets, err = NewSecretStore(cfg)
 			if err != nil {
 				return err
 			}
 
-			accounts, err := sso.ListAccounts(ssoCred)
+			err = sso.PersistConfig()
 			if err != nil {
 				return err
 			}
 
-			c, err := sso.GetCredentials(ssoCred, accounts)
+			ssoCred, err := sso.Login()
 			if err != nil {
 				return err
 			}
 
-			res, err := sso.PersistCredentials(c)
+			accounts, err := sso.ListAccounts(ssoCred)
 			if err != nil {
 				return err
 			}
-			ssoMsg := fmt.Sprintf(ssoMsgTmpl, res.Filename)
+
+			var c []*Credential
+			var res *CredentialResultInfo
+			var ssoMsg string
+			if cfg.SSOProfiles {
+				c = sso.Profiles(ssoCred, accounts)
+				res, err = sso.PersistProfiles(c)
+				if err != nil {
+					return err
+				}
+				res.ExpiresAt = ssoCred.ExpiresAt()
+				report.AddProfiles(c, nil)
+				ssoMsg = fmt.Sprintf(ssoProfilesMsgTmpl, res.Filename, sso.Session)
+			} else {
+				c, err = sso.GetCredentials(ssoCred, accounts)
+				if err != nil {
+					return err
+				}
+
+				sso.STS = &STSCli{Env: env}
+				sso.MFAToken = mfaPrompt(NewPrompt(os.Stdin, os.Stderr))
+				chained, err := sso.AssumeRoles(c)
+				if err != nil {
+					return err
+				}
+				c = append(c, chained...)
+
+				res, err = sso.PersistCredentials(c)
+				if err != nil {
+					return err
+				}
+				report.AddProfiles(c, res.Expirations)
+				ssoMsg = fmt.Sprintf(ssoMsgTmpl, res.Filename)
+				if sso.Secrets != nil {
+					ssoMsg = fmt.Sprintf(ssoSecretsMsgTmpl, cfg.SecretStore, res.Filename)
+				}
+			}
 
 			var eksMsg string
-			if opts.EKS {
-				eks := NewEKS(&EKSCli{}, cfg)
+			switch {
+			case opts.EKS && opts.DryRun && sso.Secrets != nil && !cfg.SSOProfiles:
+				// the profiles read the credentials from the secret store, which a dry run does not update
+				logger.Warn().Msg("dry run, the eks clusters are not updated because the credentials are not written to the secret store")
+			case opts.EKS:
+				eks := NewEKS(&EKSCli{Env: env}, cfg)
+				eks.Sandbox = sandbox
+				eks.Report = report
 				err := eks.UpdateKubeConfig(c)
 				if err != nil {
 					return err
 				}
 
 				eksMsg = fmt.Sprintf(eksMsgTmpl, eks.KubeConfigPath)
+				if eks.Split() {
+					eksMsg = fmt.Sprintf(eksSplitMsgTmpl, len(eks.KubeConfigPaths), eks.KubeConfigDir, eks.PathsFile())
+				}
 			}
 
-			logger.Info().Msgf(msgTmpl, ssoMsg, eksMsg, res.ExpiresAt)
+			if opts.DryRun {
+				var out io.Writer = os.Stdout
+				if report != nil {
+					out = os.Stderr
+				}
+
+				changed, err := sandbox.Diff(out)
+				if err != nil {
+					return err
+				}
+
+				logger.Info().Msgf("dry run: %d files would be changed, no file has been written", changed)
+				return nil
+			}
+
+			if report != nil {
+				return nil
+			}
+
+			logger.Info().Msgf(msgTmpl, ssoMsg, eksMsg, res.Summary(cfg.ShortSessionDuration()))
 
 			return nil
 		},
 	}
 
 	rootCmd.PersistentFlags().StringP("loglevel", "d", "info", "set log level [info|debug|trace]")
-	rootCmd.PersistentFlags().BoolVarP(&opts.Backup, "backup", "b", false, "force a back up of the configuration files [.aws/config|.aws/credentials|.kube/config]")
 	rootCmd.PersistentFlags().BoolVarP(&opts.EKS, "eks", "k", false, "configure kubectl so that you can connect to an Amazon EKS cluster")
-	rootCmd.PersistentFlags().BoolVarP(&opts.ForceSSOLogin, "login", "l", false, "force login to review the SSO access token")
+	rootCmd.PersistentFlags().BoolVar(&opts.DryRun, "dry-run", false, "print a diff of the changes instead of writing the configuration files")
+	rootCmd.Flags().StringVarP(&opts.Output, "output", "o", OutputText, "print the result as [text|json], the json result is printed to stdout")
+	rootCmd.PersistentFlags().Bool("unsafe-log-secrets", false, "do not redact the access tokens and secret keys from the log output")
+	AddConfigFlags(rootCmd.PersistentFlags(), flagConfig)
 
-	logger.Logger = logger.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+	setLogOutput(os.Args)
 	setLogLevel(os.Args)
 
 	ctx, cancel := context.WithTimeout(context.TODO(), 30*time.Second)
@@ -117,6 +232,13 @@ func main() {
 
 	rootCmd.AddCommand([]*cobra.Command{
 		configureCmd(ctx),
+		configCmd(ctx),
+		backupCmd(ctx),
+		backupRestoreCmd(ctx),
+		listCmd(ctx),
+		consoleCmd(ctx),
+		pickCmd(ctx),
+		credentialProcessCmd(ctx),
 		versionCmd(ctx),
 	}...)
 
@@ -126,6 +248,29 @@ func main() {
 	}
 }
 
+// setLogOutput redacts the secrets from the log output unless --unsafe-log-secrets is given
+func setLogOutput(args []string) {
+	var out io.Writer = zerolog.ConsoleWriter{Out: os.Stderr}
+
+	unsafe := false
+	for _, a := range args {
+		if a == "--unsafe-log-secrets" || a == "--unsafe-log-secrets=true" {
+			unsafe = true
+			break
+		}
+	}
+
+	if !unsafe {
+		out = &RedactWriter{Out: out}
+	}
+
+	logger.Logger = logger.Output(out)
+
+	if unsafe {
+		logger.Warn().Msg("the access tokens and secret keys are not redacted from the log output, do not share it")
+	}
+}
+
 func setLogLevel(args []string) {
 	level := "info"
 	for i, a := range args {
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	logger "github.com/rs/zerolog/log"
+)
+
+// insecurePerm defines the permission bits that allow other users to access a file
+const insecurePerm os.FileMode = 0077
+
+// PermissionPolicy defines how the files that other users can access are handled
+type PermissionPolicy struct {
+	// Keep only warns about the insecure permissions instead of tightening them
+	Keep bool
+	// Force writes secrets to files that other users can access
+	Force bool
+}
+
+// permissions is the policy applied to every file read or written by asl
+var permissions = &PermissionPolicy{}
+
+// Audit checks the ownership and mode of a file before it is read or written. Reading never
+// changes the file, it only warns about secrets that other users can access. Before writing
+// secrets, the group and others permissions are removed unless the policy keeps them, and
+// writing to a file that other users can access, or that is owned by another user, is refused
+// unless forced. The mode of the files without secrets is left as it is.
+func (p *PermissionPolicy) Audit(path string, secret, write bool) error {
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return nil
+	}
+
+	// symlinks are followed, e.g. dotfiles managed in a git repository
+	if fi.Mode()&os.ModeSymlink != 0 {
+		if fi, err = os.Stat(path); err != nil {
+			return nil
+		}
+	}
+
+	insecure := false
+
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok && int(st.Uid) != os.Getuid() {
+		logger.Warn().Str("path", path).Uint32("uid", st.Uid).Msg("the file is owned by another user")
+		insecure = true
+	}
+
+	perm := fi.Mode().Perm()
+	if perm&insecurePerm != 0 && secret {
+		if write && !p.Keep && !insecure {
+			tightened := perm &^ insecurePerm
+			if err := os.Chmod(path, tightened); err != nil {
+				return fmt.Errorf("tightening the permissions of %s: %w", path, err)
+			}
+
+			logger.Info().Str("path", path).Msgf("the permissions have been tightened from %04o to %04o", perm, tightened)
+			return nil
+		}
+
+		logger.Warn().Str("path", path).Msgf("the file can be accessed by other users (%04o), run: chmod 600 %s", perm, path)
+		insecure = true
+	}
+
+	if insecure && secret && write {
+		if p.Force {
+			logger.Warn().Str("path", path).Msg("writing secrets to a file that other users can access")
+			return nil
+		}
+
+		return fmt.Errorf("refusing to write secrets to %s because other users can access it, fix its ownership and permissions (chmod 600 %s) or use --force-insecure-permissions", path, path)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func withPermissions(t *testing.T, p *PermissionPolicy) {
+	old := permissions
+	permissions = p
+	t.Cleanup(func() { permissions = old })
+}
+
+func TestAuditTightensPermissions(t *testing.T) {
+	withPermissions(t, &PermissionPolicy{})
+
+	filename := filepath.Join(t.TempDir(), "credentials")
+	_ = os.WriteFile(filename, []byte("foo"), 0644)
+
+	f := NewFile(filename)
+	f.Secret = true
+	require.Nil(t, f.WriteAtomic([]byte("bar")))
+
+	fi, _ := os.Stat(filename)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+}
+
+func TestAuditReadOnlyWarns(t *testing.T) {
+	withPermissions(t, &PermissionPolicy{})
+
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "credentials")
+	_ = os.WriteFile(filename, []byte("foo"), 0644)
+
+	f := NewFile(filename)
+	f.Secret = true
+	_, err := f.Read()
+	require.Nil(t, err)
+
+	// a dry run copies the files to the sandbox without changing them
+	s, err := NewSandbox()
+	require.Nil(t, err)
+	defer s.Close()
+	_, err = s.Path(filename)
+	require.Nil(t, err)
+
+	fi, _ := os.Stat(filename)
+	require.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+
+	// the files without secrets keep their mode when they are written
+	config := filepath.Join(dir, "config")
+	_ = os.WriteFile(config, []byte("foo"), 0644)
+	require.Nil(t, NewFile(config).WriteAtomic([]byte("bar")))
+
+	fi, _ = os.Stat(config)
+	require.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+}
+
+func TestAuditRefusesSecrets(t *testing.T) {
+	withPermissions(t, &PermissionPolicy{Keep: true})
+
+	filename := filepath.Join(t.TempDir(), "credentials")
+	_ = os.WriteFile(filename, []byte("foo"), 0644)
+
+	f := NewFile(filename)
+	f.Secret = true
+	err := f.WriteAtomic([]byte("bar"))
+	require.NotNil(t, err)
+	require.Contains(t, err.Error(), "refusing to write secrets to "+filename)
+
+	b, _ := os.ReadFile(filename)
+	require.Equal(t, "foo", string(b))
+
+	// reading and writing files without secrets only warns
+	config := NewFile(filename)
+	_, err = config.Read()
+	require.Nil(t, err)
+	require.Nil(t, config.WriteAtomic([]byte("baz")))
+
+	permissions.Force = true
+	require.Nil(t, f.WriteAtomic([]byte("bar")))
+
+	fi, _ := os.Stat(filename)
+	require.Equal(t, os.FileMode(0644), fi.Mode().Perm())
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+const (
+	defaultPickHeight = 10
+
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyBackspace = 8
+	keyEnter     = '\r'
+	keyNewLine   = '\n'
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+var errPickCanceled = errors.New("no profile has been picked")
+
+// PickItem defines a profile offered by asl pick, the account and the role are
+// empty when they are not known, e.g. the credentials profiles of the last run
+type PickItem struct {
+	Profile     string
+	AccountID   string
+	AccountName string
+	RoleName    string
+	Region      string
+}
+
+// Picker is an incremental fuzzy search over the profiles, it reads the keys from a
+// terminal in raw mode and draws the matches below the prompt
+type Picker struct {
+	In     io.Reader
+	Out    io.Writer
+	Items  []*PickItem
+	Query  string
+	Height int
+	Width  int
+}
+
+func pickCmd(ctx context.Context) *cobra.Command {
+	var live, export, exec, console bool
+	var query string
+
+	cmd := &cobra.Command{
+		Use:   "pick [-- command [args...]]",
+		Short: "Pick a profile with a fuzzy search and print it, export it, run a command or open the console with it",
+		Example: `  export AWS_PROFILE=$(asl pick)
+  eval "$(asl pick --export)"
+  asl pick --exec -- aws s3 ls
+  asl pick --console`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			actions := 0
+			for _, a := range []bool{export, exec, console} {
+				if a {
+					actions++
+				}
+			}
+			if actions > 1 {
+				return errors.New("only one of --export, --exec and --console can be used")
+			}
+			if exec && len(args) == 0 {
+				return errors.New("no command has been given, e.g. asl pick --exec -- aws s3 ls")
+			}
+
+			cfg, err := LoadConfig(cmd.Flags(), flagConfig)
+			if err != nil {
+				return err
+			}
+
+			var items []*PickItem
+			if live {
+				_, profiles, err := ListProfiles(cfg)
+				if err != nil {
+					return err
+				}
+				items = PickItems(profiles)
+			} else {
+				items, err = LastRunProfiles(NewAWSFiles(cfg), cfg.BootstrapProfileName())
+				if err != nil {
+					return err
+				}
+			}
+
+			if len(items) == 0 {
+				return errors.New("no profiles have been found, please run: asl")
+			}
+
+			item, err := pickTerminal(items, query)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case export:
+				for _, e := range pickEnv(item) {
+					kv := strings.SplitN(e, "=", 2)
+					fmt.Printf("export %s=%s\n", kv[0], shellQuote(kv[1]))
+				}
+			case exec:
+				c := execCommand(args[0], args[1:]...)
+				c.Env = append(os.Environ(), pickEnv(item)...)
+				c.Stdin, c.Stdout, c.Stderr = os.Stdin, os.Stdout, os.Stderr
+				return c.Run()
+			case console:
+				o := &ConsoleOptions{Service: defaultConsoleService, Endpoint: defaultFederationEndpoint, Duration: time.Hour, Open: true}
+				// the startup context may have expired while the user was picking
+				return o.Run(context.Background(), cfg, item.Profile)
+			default:
+				fmt.Println(item.Profile)
+			}
+
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&live, "live", false, "list the accounts and roles assigned to the user instead of the profiles of the last run")
+	cmd.Flags().StringVarP(&query, "query", "q", "", "the initial search query")
+	cmd.Flags().BoolVar(&export, "export", false, "print the export commands of AWS_PROFILE and AWS_REGION, e.g. eval \"$(asl pick --export)\"")
+	cmd.Flags().BoolVar(&exec, "exec", false, "run the command given after -- with AWS_PROFILE and AWS_REGION")
+	cmd.Flags().BoolVar(&console, "console", false, "open the AWS web console with the picked profile")
+
+	return cmd
+}
+
+// pickTerminal runs the picker on the controlling terminal, so stdout can be captured by the shell
+func pickTerminal(items []*PickItem, query string) (*PickItem, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("asl pick needs a terminal: %w", err)
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = term.Restore(fd, state) }()
+
+	// the lines are not truncated when the size is unknown
+	width, _, _ := term.GetSize(fd)
+
+	p := &Picker{In: tty, Out: tty, Items: items, Query: query, Height: defaultPickHeight, Width: width}
+	return p.Run()
+}
+
+// pickEnv returns the environment variables of the picked profile
+func pickEnv(item *PickItem) []string {
+	env := []string{"AWS_PROFILE=" + item.Profile}
+	if item.Region != "" {
+		env = append(env, "AWS_REGION="+item.Region)
+	}
+	return env
+}
+
+// shellQuote quotes a value for the posix shells, the profile names may hold any character of the account name
+func shellQuote(v string) string {
+	return "'" + strings.ReplaceAll(v, "'", `'\''`) + "'"
+}
+
+// PickItems returns the items of the profiles listed by the SSO
+func PickItems(profiles []*Credential) []*PickItem {
+	var items []*PickItem
+	for _, p := range profiles {
+		items = append(items, &PickItem{Profile: p.ProfileName, AccountID: p.AccountID, AccountName: p.AccountName, RoleName: p.RoleName, Region: p.Region})
+	}
+	return items
+}
+
+// LastRunProfiles returns the profiles written by the last run, the sso and chained profiles
+// managed by asl in the aws config file and the credentials profiles that have an expiration
+func LastRunProfiles(files *AWSFiles, bootstrap string) ([]*PickItem, error) {
+	var items []*PickItem
+	seen := map[string]*PickItem{}
+
+	config := NewFile(files.Config)
+	b, err := config.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cfg := ParseIni(b)
+	for _, s := range cfg.Sections() {
+		name := strings.TrimPrefix(s, "profile ")
+		if name == s || name == bootstrap || !managed(cfg, s) {
+			continue
+		}
+
+		item := &PickItem{Profile: name}
+		item.AccountID, _ = cfg.Get(s, keySSOAccountID)
+		item.RoleName, _ = cfg.Get(s, keySSORoleName)
+		item.Region, _ = cfg.Get(s, keyRegion)
+		if arn, ok := cfg.Get(s, keyRoleARN); ok {
+			if m := matchRoleARN.FindStringSubmatch(arn); m != nil {
+				item.AccountID, item.RoleName = m[1], m[2]
+			}
+		}
+
+		seen[name] = item
+		items = append(items, item)
+	}
+
+	cred := NewFile(files.Credentials)
+	cred.Secret = true
+	b, err = cred.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cfg = ParseIni(b)
+	for _, s := range cfg.Sections() {
+		if _, ok := cfg.Get(s, keyExpiration); !ok || seen[s] != nil {
+			continue
+		}
+
+		item := &PickItem{Profile: s}
+		item.Region, _ = cfg.Get(s, keyRegion)
+
+		seen[s] = item
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// FuzzyScore returns if all the characters of the query appear in the text in the same order,
+// ignoring the case. The score favors consecutive characters and the start of the words.
+func FuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(text))
+
+	score, qi, prev := 0, 0, -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+
+		score++
+		if ti == prev+1 {
+			score += 5
+		}
+		if ti == 0 || strings.ContainsRune(" -_/.()", t[ti-1]) {
+			score += 3
+		}
+
+		prev = ti
+		qi++
+	}
+
+	return score, qi == len(q)
+}
+
+// FilterPickItems returns the items that match the query, the best matches first
+func FilterPickItems(items []*PickItem, query string) []*PickItem {
+	type match struct {
+		item  *PickItem
+		score int
+	}
+
+	var matches []match
+	for _, i := range items {
+		if score, ok := FuzzyScore(query, i.search()); ok {
+			matches = append(matches, match{i, score})
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].score > matches[j].score
+	})
+
+	filtered := make([]*PickItem, len(matches))
+	for i, m := range matches {
+		filtered[i] = m.item
+	}
+
+	return filtered
+}
+
+func (i *PickItem) search() string {
+	return strings.Join([]string{i.Profile, i.AccountName, i.AccountID, i.RoleName}, " ")
+}
+
+// Run reads the keys until a profile is picked, Enter picks the selected profile,
+// the arrows or Ctrl-P and Ctrl-N move the selection and Esc or Ctrl-C cancels
+func (p *Picker) Run() (*PickItem, error) {
+	r := bufio.NewReader(p.In)
+	query := []rune(p.Query)
+	matches := FilterPickItems(p.Items, p.Query)
+	selected := 0
+
+	for {
+		p.render(string(query), matches, selected)
+
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			p.clear()
+			return nil, errPickCanceled
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		changed := false
+		switch b {
+		case keyEnter, keyNewLine:
+			if len(matches) == 0 {
+				continue
+			}
+			p.clear()
+			return matches[selected], nil
+		case keyCtrlC, keyCtrlD:
+			p.clear()
+			return nil, errPickCanceled
+		case keyEscape:
+			// a lone escape cancels, the arrows are sent as escape sequences
+			if r.Buffered() == 0 {
+				p.clear()
+				return nil, errPickCanceled
+			}
+			seq := make([]byte, 2)
+			if _, err := io.ReadFull(r, seq); err != nil {
+				return nil, err
+			}
+			if seq[0] == '[' && seq[1] == 'A' {
+				selected--
+			}
+			if seq[0] == '[' && seq[1] == 'B' {
+				selected++
+			}
+		case keyCtrlP:
+			selected--
+		case keyCtrlN:
+			selected++
+		case keyBackspace, keyDelete:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+				changed = true
+			}
+		case keyCtrlU:
+			query = nil
+			changed = true
+		default:
+			if b < ' ' {
+				continue
+			}
+			if b >= utf8.RuneSelf {
+				_ = r.UnreadByte()
+				c, _, err := r.ReadRune()
+				if err != nil {
+					return nil, err
+				}
+				query = append(query, c)
+			} else {
+				query = append(query, rune(b))
+			}
+			changed = true
+		}
+
+		if changed {
+			matches = FilterPickItems(p.Items, string(query))
+			selected = 0
+		}
+
+		if selected < 0 {
+			selected = 0
+		}
+		if selected >= len(matches) {
+			selected = len(matches) - 1
+		}
+	}
+}
+
+// render draws the prompt and the matches around the selection, the cursor is left after the query
+func (p *Picker) render(query string, matches []*PickItem, selected int) {
+	height := p.Height
+	if height <= 0 {
+		height = defaultPickHeight
+	}
+
+	start := 0
+	if selected >= height {
+		start = selected - height + 1
+	}
+	end := start + height
+	if end > len(matches) {
+		end = len(matches)
+	}
+
+	width := 0
+	for _, i := range matches[start:end] {
+		if n := utf8.RuneCountInString(i.Profile); n > width {
+			width = n
+		}
+	}
+
+	prompt := fmt.Sprintf("%d/%d > %s", len(matches), len(p.Items), query)
+
+	var b strings.Builder
+	b.WriteString("\r\033[J" + prompt)
+	for i := start; i < end; i++ {
+		line := p.truncate(fmt.Sprintf("  %-*s  %s", width, matches[i].Profile, matches[i].describe()))
+		if i == selected {
+			line = "\033[7m" + line + "\033[0m"
+		}
+		b.WriteString("\r\n" + line)
+	}
+	if end > start {
+		fmt.Fprintf(&b, "\033[%dA", end-start)
+	}
+	b.WriteString("\r" + prompt)
+
+	fmt.Fprint(p.Out, b.String())
+}
+
+// clear removes the prompt and the matches from the terminal
+func (p *Picker) clear() {
+	fmt.Fprint(p.Out, "\r\033[J")
+}
+
+// truncate keeps the lines in the terminal width, otherwise the wrapped lines move the prompt
+func (p *Picker) truncate(line string) string {
+	if p.Width <= 0 || utf8.RuneCountInString(line) < p.Width {
+		return line
+	}
+	return string([]rune(line)[:p.Width-1])
+}
+
+func (i *PickItem) describe() string {
+	var parts []string
+	if i.AccountName != "" {
+		parts = append(parts, i.AccountName)
+	}
+	if i.AccountID != "" {
+		parts = append(parts, "("+i.AccountID+")")
+	}
+	if i.RoleName != "" {
+		parts = append(parts, i.RoleName)
+	}
+	return strings.Join(parts, " ")
+}
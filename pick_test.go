@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var pickItems = []*PickItem{
+	{Profile: "my-account", AccountID: "123456789012", AccountName: "My Account", RoleName: "AdministratorAccess"},
+	{Profile: "my-account-read-only", AccountID: "123456789012", AccountName: "My Account", RoleName: "ReadOnly"},
+	{Profile: "mine", AccountID: "210987654321", AccountName: "Mine", RoleName: "ReadOnly", Region: "eu-west-1"},
+}
+
+func TestFuzzyScore(t *testing.T) {
+	_, ok := FuzzyScore("mro", "my-account-read-only")
+	require.True(t, ok)
+
+	_, ok = FuzzyScore("orm", "my-account-read-only")
+	require.False(t, ok)
+
+	consecutive, _ := FuzzyScore("read", "my-account-read-only")
+	scattered, _ := FuzzyScore("read", "root-external-admin-dev")
+	require.Greater(t, consecutive, scattered)
+}
+
+func TestFilterPickItems(t *testing.T) {
+	require.Equal(t, pickItems, FilterPickItems(pickItems, ""))
+	require.Equal(t, []*PickItem{pickItems[1], pickItems[2]}, FilterPickItems(pickItems, "read"))
+	require.Equal(t, []*PickItem{pickItems[2]}, FilterPickItems(pickItems, "2109"))
+}
+
+func TestPickerRun(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		keys  string
+		query string
+		want  *PickItem
+		err   error
+	}{
+		{name: "enter picks the first match", keys: "\r", want: pickItems[0]},
+		{name: "query", keys: "mine\r", want: pickItems[2]},
+		{name: "arrows", keys: "\x1b[B\x1b[B\x1b[B\x1b[A\r", want: pickItems[1]},
+		{name: "ctrl-n and ctrl-p", keys: "\x0e\x0e\x10\r", want: pickItems[1]},
+		{name: "backspace", keys: "minx\x7f\r", want: pickItems[2]},
+		{name: "initial query", query: "read", keys: "\x15\r", want: pickItems[0]},
+		{name: "no match", keys: "zzz\r\x03", err: errPickCanceled},
+		{name: "escape", keys: "\x1b", err: errPickCanceled},
+		{name: "eof", keys: "my", err: errPickCanceled},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out bytes.Buffer
+			p := &Picker{In: strings.NewReader(tc.keys), Out: &out, Items: pickItems, Query: tc.query, Height: 2, Width: 30}
+
+			item, err := p.Run()
+			require.Equal(t, tc.err, err)
+			require.Equal(t, tc.want, item)
+			require.True(t, strings.HasSuffix(out.String(), "\r\033[J"))
+		})
+	}
+}
+
+func TestPickEnv(t *testing.T) {
+	require.Equal(t, []string{"AWS_PROFILE=mine", "AWS_REGION=eu-west-1"}, pickEnv(pickItems[2]))
+	require.Equal(t, []string{"AWS_PROFILE=my-account"}, pickEnv(pickItems[0]))
+	require.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
+
+func TestLastRunProfiles(t *testing.T) {
+	dir := t.TempDir()
+	withPermissions(t, &PermissionPolicy{})
+	files := &AWSFiles{Config: filepath.Join(dir, "config"), Credentials: filepath.Join(dir, "credentials")}
+
+	_ = os.WriteFile(files.Config, []byte(managedComment+`
+[profile asl-bootstrap]
+sso_account_id = 123456789012
+sso_role_name = ReadOnly
+
+`+managedComment+`
+[profile my-account]
+sso_session = asl
+sso_account_id = 123456789012
+sso_role_name = AdministratorAccess
+region = us-east-1
+
+`+managedComment+`
+[profile prod-deploy]
+role_arn = arn:aws:iam::999999999999:role/ci/Deploy
+source_profile = my-account
+
+[profile mine]
+region = eu-west-1
+`), 0600)
+	_ = os.WriteFile(files.Credentials, []byte(`[default]
+aws_access_key_id = AKIA
+
+[my-account-read-only]
+region = us-east-1
+aws_expiration = 2030-01-01T10:00:00Z
+`), 0600)
+
+	items, err := LastRunProfiles(files, "asl-bootstrap")
+	require.Nil(t, err)
+	require.Equal(t, []*PickItem{
+		{Profile: "my-account", AccountID: "123456789012", RoleName: "AdministratorAccess", Region: "us-east-1"},
+		{Profile: "prod-deploy", AccountID: "999999999999", RoleName: "Deploy"},
+		{Profile: "my-account-read-only", Region: "us-east-1"},
+	}, items)
+}
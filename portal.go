@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	logger "github.com/rs/zerolog/log"
+)
+
+// Portal defines an additional AWS SSO user portal, it is chosen by name with the --portal flag
+type Portal struct {
+	Name       string `json:"name"`
+	StartURL   string `json:"startUrl"`
+	Region     string `json:"region"`
+	AccountID  string `json:"accountId"`
+	RoleName   string `json:"roleName"`
+	Bootstrap  string `json:"bootstrapProfile,omitempty"`
+	SSOSession string `json:"ssoSession,omitempty"`
+}
+
+// UsePortal replaces the config file values by the ones of the chosen portal, the values
+// set by environment variables and flags are kept. Every portal has its own bootstrap
+// profile and sso-session by default, so the portals do not overwrite each other.
+func (o *ConfigOptions) UsePortal() error {
+	if o.Portal == "" {
+		return nil
+	}
+
+	var p *Portal
+	var names []string
+	for _, v := range o.Portals {
+		names = append(names, v.Name)
+		if v.Name == o.Portal {
+			p = v
+		}
+	}
+
+	if p == nil {
+		return fmt.Errorf("the portal %q is not defined in the asl config file, the available portals are: [%s]", o.Portal, strings.Join(names, "|"))
+	}
+
+	bootstrap, session := p.Bootstrap, p.SSOSession
+	if bootstrap == "" {
+		bootstrap = DefaultBootstrapProfile + "-" + p.Name
+	}
+	if session == "" {
+		session = DefaultSSOSession + "-" + p.Name
+	}
+
+	set := func(name string, field *string, value string) {
+		if s := o.Source(name); s == SourceEnv || s == SourceFlag {
+			return
+		}
+		*field = value
+		if value != "" {
+			o.Sources[name] = SourceFile
+		} else {
+			delete(o.Sources, name)
+		}
+	}
+
+	set("startUrl", &o.StartURL, p.StartURL)
+	set("region", &o.Region, p.Region)
+	set("accountId", &o.AccountID, p.AccountID)
+	set("roleName", &o.RoleName, p.RoleName)
+	set("bootstrapProfile", &o.Bootstrap, bootstrap)
+	set("ssoSession", &o.SSOSession, session)
+
+	logger.Debug().Str("portal", p.Name).Str("startUrl", o.StartURL).Msg("using the portal")
+
+	return nil
+}
+
+// ImportPortals reads the sso profiles of the aws config file, legacy profiles (sso_start_url) and
+// profiles that reference a sso-session are supported. The profiles are grouped by start URL, the first
+// profile found for a start URL defines the account and role of the portal. When no profile is given,
+// all the sso profiles that are not managed by asl are imported.
+func ImportPortals(cfg *IniFile, profiles []string) ([]*Portal, error) {
+	sections := cfg.Sections()
+	if len(profiles) > 0 {
+		sections = nil
+		for _, name := range profiles {
+			s := profileSection(name)
+			if name == "default" && !cfg.HasSection(s) {
+				s = name
+			}
+
+			if !cfg.HasSection(s) {
+				return nil, fmt.Errorf("the profile %s does not exist in the aws config file", name)
+			}
+
+			sections = append(sections, s)
+		}
+	}
+
+	var portals []*Portal
+	byURL := map[string]*Portal{}
+	for _, s := range sections {
+		if (s != "default" && !strings.HasPrefix(s, "profile ")) || managed(cfg, s) {
+			continue
+		}
+
+		name := strings.TrimPrefix(s, "profile ")
+
+		p, err := ssoProfile(cfg, s)
+		if err != nil {
+			return nil, fmt.Errorf("the profile %s can not be imported: %w", name, err)
+		}
+
+		if p == nil {
+			if len(profiles) > 0 {
+				return nil, fmt.Errorf("the profile %s is not a sso profile", name)
+			}
+			continue
+		}
+
+		if _, ok := byURL[p.StartURL]; ok {
+			continue
+		}
+
+		logger.Debug().Str("profile", name).Str("portal", p.Name).Str("startUrl", p.StartURL).Msg("sso profile found")
+
+		byURL[p.StartURL] = p
+		portals = append(portals, p)
+	}
+
+	if len(portals) == 0 {
+		return nil, fmt.Errorf("no sso profile has been found in the aws config file")
+	}
+
+	return portals, nil
+}
+
+// ssoProfile returns the portal defined by a profile section, it is nil when the profile does not use AWS SSO
+func ssoProfile(cfg *IniFile, section string) (*Portal, error) {
+	session, _ := cfg.Get(section, keySSOSession)
+
+	source := section
+	if session != "" {
+		source = ssoSessionSection(session)
+		if !cfg.HasSection(source) {
+			return nil, fmt.Errorf("the sso-session %s does not exist", session)
+		}
+	}
+
+	startURL, _ := cfg.Get(source, keySSOUrl)
+	if startURL == "" {
+		return nil, nil
+	}
+
+	region, _ := cfg.Get(source, keySSORegion)
+	accountID, _ := cfg.Get(section, keySSOAccountID)
+	roleName, _ := cfg.Get(section, keySSORoleName)
+
+	return &Portal{
+		Name:      portalName(startURL, session),
+		StartURL:  startURL,
+		Region:    region,
+		AccountID: accountID,
+		RoleName:  roleName,
+	}, nil
+}
+
+// portalName returns the sso-session name or the first label of the start URL host, e.g. my-company for https://my-company.awsapps.com/start
+func portalName(startURL, session string) string {
+	if session != "" {
+		return session
+	}
+
+	u, err := url.Parse(startURL)
+	if err != nil || u.Hostname() == "" {
+		return startURL
+	}
+
+	return strings.Split(u.Hostname(), ".")[0]
+}
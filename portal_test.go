@@ -0,0 +1,125 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+const awsConfigWithSSOProfiles = `[default]
+region = us-east-1
+
+[profile dev]
+sso_start_url = https://my-company.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 123456789012
+sso_role_name = Developer
+
+[profile prod]
+sso_start_url = https://my-company.awsapps.com/start
+sso_region = us-east-1
+sso_account_id = 210987654321
+sso_role_name = ReadOnly
+
+[profile partner]
+sso_session = partner
+sso_account_id = 111111111111
+sso_role_name = AdministratorAccess
+
+[sso-session partner]
+sso_start_url = https://d-123456w78w.awsapps.com/start
+sso_region = eu-west-1
+
+` + managedComment + `
+[profile asl-bootstrap]
+sso_start_url = https://asl.awsapps.com/start
+sso_region = us-east-1
+`
+
+func TestImportPortals(t *testing.T) {
+	cfg := ParseIni([]byte(awsConfigWithSSOProfiles))
+
+	portals, err := ImportPortals(cfg, nil)
+	require.Nil(t, err)
+	require.Equal(t, []*Portal{
+		{Name: "my-company", StartURL: "https://my-company.awsapps.com/start", Region: "us-east-1", AccountID: "123456789012", RoleName: "Developer"},
+		{Name: "partner", StartURL: "https://d-123456w78w.awsapps.com/start", Region: "eu-west-1", AccountID: "111111111111", RoleName: "AdministratorAccess"},
+	}, portals)
+
+	portals, err = ImportPortals(cfg, []string{"prod"})
+	require.Nil(t, err)
+	require.Len(t, portals, 1)
+	require.Equal(t, "210987654321", portals[0].AccountID)
+
+	_, err = ImportPortals(cfg, []string{"default"})
+	require.EqualError(t, err, "the profile default is not a sso profile")
+
+	_, err = ImportPortals(cfg, []string{"foo"})
+	require.EqualError(t, err, "the profile foo does not exist in the aws config file")
+}
+
+func TestImportPortalsKeepsTheDefault(t *testing.T) {
+	dir := withAWSPath(t)
+	_ = os.WriteFile(filepath.Join(dir, "config"), []byte(awsConfigWithSSOProfiles), 0600)
+
+	o := &ConfigOptions{}
+	require.Nil(t, importPortals(o, nil))
+	require.Equal(t, "https://my-company.awsapps.com/start", o.StartURL)
+	require.Equal(t, "123456789012", o.AccountID)
+	require.Len(t, o.Portals, 2)
+	require.Equal(t, "my-company", o.Portals[0].Name)
+	require.Equal(t, "partner", o.Portals[1].Name)
+
+	o = &ConfigOptions{StartURL: "https://foo.awsapps.com/start"}
+	require.Nil(t, importPortals(o, []string{"partner"}))
+	require.Equal(t, "https://foo.awsapps.com/start", o.StartURL)
+	require.Equal(t, "111111111111", o.AccountID)
+	require.Len(t, o.Portals, 1)
+}
+
+func TestLoadConfigPortal(t *testing.T) {
+	withASLPath(t, `{"startUrl": "https://my-company.awsapps.com/start", "region": "us-east-1", "accountId": "123456789012", "roleName": "Developer",
+	"portals": [{"name": "partner", "startUrl": "https://d-123456w78w.awsapps.com/start", "region": "eu-west-1", "accountId": "111111111111", "roleName": "AdministratorAccess"}]}`)
+
+	values := &ConfigOptions{}
+	flags := pflag.NewFlagSet("asl", pflag.ContinueOnError)
+	AddConfigFlags(flags, values)
+	require.Nil(t, flags.Parse([]string{"--portal", "partner", "--role-name", "ReadOnly"}))
+
+	cfg, err := LoadConfig(flags, values)
+	require.Nil(t, err)
+	require.Nil(t, cfg.Validate())
+
+	require.Equal(t, "https://d-123456w78w.awsapps.com/start", cfg.StartURL)
+	require.Equal(t, "eu-west-1", cfg.Region)
+	require.Equal(t, "111111111111", cfg.AccountID)
+	require.Equal(t, "ReadOnly", cfg.RoleName)
+	require.Equal(t, "asl-bootstrap-partner", cfg.BootstrapProfileName())
+	require.Equal(t, "asl-partner", cfg.SSOSessionName())
+	require.Equal(t, SourceFlag, cfg.Source("roleName"))
+
+	t.Setenv("ASL_PORTAL", "foo")
+	_, err = LoadConfig(nil, nil)
+	require.EqualError(t, err, `the portal "foo" is not defined in the asl config file, the available portals are: [partner]`)
+}
+
+func TestLoadConfigPortalsOverride(t *testing.T) {
+	withASLPath(t, `{"startUrl": "https://my-company.awsapps.com/start", "region": "us-east-1", "accountId": "123456789012", "roleName": "Developer"}`)
+
+	t.Setenv("ASL_PORTALS", `[{"name": "partner", "startUrl": "https://d-123456w78w.awsapps.com/start", "region": "eu-west-1", "accountId": "111111111111", "roleName": "ReadOnly"}]`)
+	t.Setenv("ASL_PORTAL", "partner")
+
+	cfg, err := LoadConfig(nil, nil)
+	require.Nil(t, err)
+	require.Equal(t, "https://d-123456w78w.awsapps.com/start", cfg.StartURL)
+	require.Equal(t, SourceEnv, cfg.Source("portals"))
+
+	for _, f := range configFields {
+		if f.Name == "portals" {
+			require.Contains(t, cfg.FieldValue(f), `"name":"partner"`)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	logger "github.com/rs/zerolog/log"
+)
+
+// defaultProfileKeys defines the keys written to every profile unless they are overridden
+var defaultProfileKeys = map[string]string{"output": "json"}
+
+// ProfileOptions defines the region and the additional keys written to the profiles
+type ProfileOptions struct {
+	Region    string             `json:"region,omitempty"`
+	Keys      map[string]string  `json:"keys,omitempty"`
+	Overrides []*ProfileOverride `json:"overrides,omitempty"`
+}
+
+// ProfileOverride defines the region and the keys of the profiles whose account and role match,
+// the account matches by ID or name and all patterns use the shell file name pattern syntax
+type ProfileOverride struct {
+	Account string            `json:"account,omitempty"`
+	Role    string            `json:"role,omitempty"`
+	Region  string            `json:"region,omitempty"`
+	Keys    map[string]string `json:"keys,omitempty"`
+}
+
+// Match returns if the override applies to a given profile, an empty pattern matches any value
+func (o *ProfileOverride) Match(p *Credential) bool {
+	if o.Account != "" && !MatchAny([]string{o.Account}, p.AccountID) && !MatchAny([]string{o.Account}, p.AccountName) {
+		return false
+	}
+
+	return o.Role == "" || MatchAny([]string{o.Role}, p.RoleName)
+}
+
+// Apply sets the region and the keys of a profile, the default region is overridden by the
+// options region and then by each matching override, in the order they are declared
+func (o *ProfileOptions) Apply(p *Credential, region string) {
+	keys := map[string]string{}
+	for k, v := range defaultProfileKeys {
+		keys[k] = v
+	}
+
+	if o != nil {
+		if o.Region != "" {
+			region = o.Region
+		}
+		mergeProfileKeys(keys, o.Keys)
+
+		for _, ov := range o.Overrides {
+			if !ov.Match(p) {
+				continue
+			}
+
+			if ov.Region != "" {
+				region = ov.Region
+			}
+			mergeProfileKeys(keys, ov.Keys)
+		}
+	}
+
+	p.Region = region
+	p.Keys = keys
+}
+
+// SortedKeys returns the names of the profile keys in alphabetical order
+func (d *Credential) SortedKeys() []string {
+	var names []string
+	for k := range d.Keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// mergeProfileKeys copies the keys ignoring the ones managed by asl, an empty value removes the key
+func mergeProfileKeys(dst, src map[string]string) {
+	for k, v := range src {
+		if reservedProfileKey(k) {
+			logger.Warn().Str("key", k).Msg("ignoring the profile key that is managed by asl")
+			continue
+		}
+
+		if v == "" {
+			delete(dst, k)
+			continue
+		}
+
+		dst[k] = v
+	}
+}
+
+func reservedProfileKey(k string) bool {
+	return k == keyRegion || strings.HasPrefix(k, "aws_") || strings.HasPrefix(k, "sso_")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyDefaultProfileOptions(t *testing.T) {
+	var o *ProfileOptions
+	p := &Credential{AccountID: "123456789012", AccountName: "Dev", RoleName: "ReadOnly"}
+	o.Apply(p, "us-east-1")
+
+	require.Equal(t, "us-east-1", p.Region)
+	require.Equal(t, map[string]string{"output": "json"}, p.Keys)
+}
+
+func TestApplyProfileOverrides(t *testing.T) {
+	o := &ProfileOptions{
+		Region: "us-west-2",
+		Keys:   map[string]string{"cli_pager": "", "retry_mode": "standard", "aws_access_key_id": "foo"},
+		Overrides: []*ProfileOverride{
+			{Account: "Prod*", Region: "eu-west-1"},
+			{Account: "210987654321", Role: "Admin*", Keys: map[string]string{"output": "table"}},
+			{Role: "ReadOnly", Region: "sa-east-1", Keys: map[string]string{"output": ""}},
+		},
+	}
+
+	dev := &Credential{AccountID: "123456789012", AccountName: "Dev", RoleName: "AdministratorAccess"}
+	o.Apply(dev, "us-east-1")
+	require.Equal(t, "us-west-2", dev.Region)
+	require.Equal(t, map[string]string{"output": "json", "retry_mode": "standard"}, dev.Keys)
+	require.Equal(t, []string{"output", "retry_mode"}, dev.SortedKeys())
+
+	admin := &Credential{AccountID: "210987654321", AccountName: "Production", RoleName: "AdministratorAccess"}
+	o.Apply(admin, "us-east-1")
+	require.Equal(t, "eu-west-1", admin.Region)
+	require.Equal(t, map[string]string{"output": "table", "retry_mode": "standard"}, admin.Keys)
+
+	ro := &Credential{AccountID: "210987654321", AccountName: "Production", RoleName: "ReadOnly"}
+	o.Apply(ro, "us-east-1")
+	require.Equal(t, "sa-east-1", ro.Region)
+	require.Equal(t, map[string]string{"retry_mode": "standard"}, ro.Keys)
+}
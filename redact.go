@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"regexp"
+	"strings"
+)
+
+const redacted = "********"
+
+// secretKeys defines the keys whose values must never be displayed
+var secretKeys = []string{
+	keyCrdSecretAccessKey,
+	keyCrdSessionToken,
+	"token",
+	"client-key-data",
+	"password",
+}
+
+// secretFields defines the json fields whose values must never be logged
+var secretFields = append([]string{
+	"accessToken",
+	"secretAccessKey",
+	"sessionToken",
+	"refreshToken",
+	"clientSecret",
+	"sessionKey",
+	"signinToken",
+}, secretKeys...)
+
+var (
+	matchSecretLine = regexp.MustCompile(`(?i)^(\s*(?:` + strings.Join(secretKeys, "|") + `)\s*[=:]\s*)(\S.*)$`)
+
+	// the fields are also matched when the json is escaped in a string, e.g. the aws cli output in a log message
+	matchSecretField = regexp.MustCompile(`(?i)(\\?"(?:` + strings.Join(secretFields, "|") + `)\\?"\s*:\s*\\?")([^"]*?)(\\?")`)
+)
+
+// RedactText masks the values of the secret keys in ini or yaml content
+func RedactText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, l := range lines {
+		lines[i] = matchSecretLine.ReplaceAllString(l, "${1}"+redacted)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// RedactJSON masks the values of the secret fields in json content
+func RedactJSON(b []byte) []byte {
+	return matchSecretField.ReplaceAll(b, []byte("${1}"+redacted+"${3}"))
+}
+
+// RedactWriter masks the secret fields of the log events before writing them
+type RedactWriter struct {
+	Out io.Writer
+}
+
+// Write redacts a log event and writes it to the underlying writer
+func (w *RedactWriter) Write(p []byte) (int, error) {
+	if _, err := w.Out.Write(RedactJSON(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactWriter(t *testing.T) {
+	var buf bytes.Buffer
+	log := zerolog.New(&RedactWriter{Out: &buf})
+
+	log.Debug().Interface("data", &SSOCredential{URL: "https://foo.awsapps.com/start", AccessToken: "secret-token"}).Msg("cache file")
+	log.Debug().Interface("credentials", &Credential{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret-key", SessionToken: "secret-session"}).Msg("credentials")
+	log.Trace().Msg(`{"roleCredentials": {"accessKeyId": "ASIAEXAMPLE", "secretAccessKey": "secret-key", "sessionToken": "secret-session"}}`)
+
+	out := buf.String()
+	for _, s := range []string{"secret-token", "secret-key", "secret-session"} {
+		require.NotContains(t, out, s)
+	}
+	require.Contains(t, out, `"accessToken":"********"`)
+	require.Contains(t, out, `\"secretAccessKey\": \"********\"`)
+	require.Contains(t, out, "ASIAEXAMPLE")
+	require.Contains(t, out, "https://foo.awsapps.com/start")
+}
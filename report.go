@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+)
+
+const (
+	// OutputText prints the result as a message in the log output
+	OutputText = "text"
+	// OutputJSON prints the result as a JSON document to stdout
+	OutputJSON = "json"
+
+	reasonUnmanaged   = "the profile already exists and it is not managed by asl"
+	reasonNotAssigned = "the source account and role of the chained profile are not assigned to the user"
+)
+
+// the aws cli prints "Added new context <arn> to <path>" or "Updated context <arn> in <path>"
+var matchKubeContext = regexp.MustCompile(`context (\S+) (?:to|in) `)
+
+// Report is the machine-readable result of a run, it is printed with --output json.
+// A nil report ignores all the calls, so the flow does not depend on the output format.
+type Report struct {
+	DryRun   bool             `json:"dryRun,omitempty"`
+	Files    []string         `json:"files"`
+	Profiles []*ProfileReport `json:"profiles"`
+	Contexts []*ContextReport `json:"eksContexts"`
+	Backups  []*Backup        `json:"backups"`
+	Failures []*FailureReport `json:"failures"`
+	Error    string           `json:"error,omitempty"`
+	files    map[string]bool
+}
+
+// ProfileReport defines a profile written to the aws files, the expiration is
+// empty for the sso profiles because the aws cli refreshes their credentials
+type ProfileReport struct {
+	Name      string     `json:"name"`
+	AccountID string     `json:"accountId"`
+	RoleName  string     `json:"roleName"`
+	Region    string     `json:"region"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ContextReport defines a kubeconfig context added for an EKS cluster
+type ContextReport struct {
+	Name       string `json:"name"`
+	Cluster    string `json:"cluster"`
+	Profile    string `json:"profile"`
+	KubeConfig string `json:"kubeconfig"`
+}
+
+// FailureReport defines a profile or cluster that has been skipped
+type FailureReport struct {
+	Profile string `json:"profile,omitempty"`
+	Cluster string `json:"cluster,omitempty"`
+	Reason  string `json:"reason"`
+}
+
+// NewReport returns a new Report
+func NewReport() *Report {
+	return &Report{
+		Files:    []string{},
+		Profiles: []*ProfileReport{},
+		Contexts: []*ContextReport{},
+		Backups:  []*Backup{},
+		Failures: []*FailureReport{},
+		files:    map[string]bool{},
+	}
+}
+
+// AddFile records a file written by the run, each file is reported once
+func (r *Report) AddFile(path string) {
+	if r == nil || r.files[path] {
+		return
+	}
+	r.files[path] = true
+	r.Files = append(r.Files, path)
+}
+
+// AddBackup records a backup created by the run
+func (r *Report) AddBackup(b *Backup) {
+	if r == nil || b == nil {
+		return
+	}
+	r.Backups = append(r.Backups, b)
+}
+
+// AddProfiles records the profiles written by the run, the skipped ones are left out
+// and the expirations are empty for the sso profiles
+func (r *Report) AddProfiles(creds []*Credential, expirations map[string]time.Time) {
+	if r == nil {
+		return
+	}
+
+	skipped := map[string]bool{}
+	for _, f := range r.Failures {
+		skipped[f.Profile] = true
+	}
+
+	for _, c := range creds {
+		if skipped[c.ProfileName] {
+			continue
+		}
+
+		p := &ProfileReport{Name: c.ProfileName, AccountID: c.AccountID, RoleName: c.RoleName, Region: c.Region}
+		if exp, ok := expirations[c.ProfileName]; ok {
+			exp = exp.UTC()
+			p.ExpiresAt = &exp
+		}
+		r.Profiles = append(r.Profiles, p)
+	}
+}
+
+// AddContext records a kubeconfig context, the name is read from the aws cli output
+// and falls back to the cluster ARN, which is the name the aws cli uses by default
+func (r *Report) AddContext(cred *Credential, cluster string, kubeconfig string, out string) {
+	if r == nil {
+		return
+	}
+
+	name := fmt.Sprintf("arn:aws:eks:%s:%s:cluster/%s", cred.Region, cred.AccountID, cluster)
+	if m := matchKubeContext.FindStringSubmatch(out); m != nil {
+		name = m[1]
+	}
+
+	r.Contexts = append(r.Contexts, &ContextReport{Name: name, Cluster: cluster, Profile: cred.ProfileName, KubeConfig: kubeconfig})
+}
+
+// AddFailure records a profile or cluster that has been skipped
+func (r *Report) AddFailure(f *FailureReport) {
+	if r == nil {
+		return
+	}
+	r.Failures = append(r.Failures, f)
+}
+
+// Write prints the report as JSON
+func (r *Report) Write(w io.Writer) error {
+	b, err := json.MarshalIndent(r, "", " ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(w, string(b))
+	return err
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNilReport(t *testing.T) {
+	var r *Report
+	r.AddFile("/tmp/config")
+	r.AddBackup(&Backup{ID: "1"})
+	r.AddProfiles([]*Credential{{ProfileName: "admin"}}, nil)
+	r.AddContext(&Credential{}, "dev", "/tmp/kube", "")
+	r.AddFailure(&FailureReport{Profile: "admin"})
+}
+
+func TestReportProfiles(t *testing.T) {
+	exp := time.Date(2030, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	r := NewReport()
+	r.AddFailure(&FailureReport{Profile: "mine", Reason: reasonUnmanaged})
+	r.AddProfiles([]*Credential{
+		{ProfileName: "admin", AccountID: "123456789012", RoleName: "AdministratorAccess", Region: "us-east-1"},
+		{ProfileName: "mine", AccountID: "210987654321", RoleName: "ReadOnly", Region: "us-east-1"},
+	}, map[string]time.Time{"admin": exp})
+
+	require.Equal(t, []*ProfileReport{
+		{Name: "admin", AccountID: "123456789012", RoleName: "AdministratorAccess", Region: "us-east-1", ExpiresAt: &exp},
+	}, r.Profiles)
+}
+
+func TestReportContexts(t *testing.T) {
+	dir := t.TempDir()
+	r := NewReport()
+
+	e := &EKS{Cmd: &EKSMock{Clusters: map[string]string{"dev": `{"clusters": ["dev-1"]}`}}, KubeConfigPath: filepath.Join(dir, "config"), Report: r}
+	err := e.UpdateKubeConfig([]*Credential{{AccountID: "123456789012", ProfileName: "dev", Region: "us-east-1"}})
+	require.Nil(t, err)
+
+	require.Equal(t, []string{filepath.Join(dir, "config")}, r.Files)
+	require.Equal(t, []*ContextReport{
+		{Name: "arn:aws:eks:us-east-1:123456789012:cluster/dev-1", Cluster: "dev-1", Profile: "dev", KubeConfig: filepath.Join(dir, "config")},
+	}, r.Contexts)
+
+	r.AddContext(&Credential{ProfileName: "dev"}, "dev-2", "/tmp/kube", "Updated context dev-2-alias in /tmp/kube\n")
+	require.Equal(t, "dev-2-alias", r.Contexts[1].Name)
+}
+
+func TestReportWrite(t *testing.T) {
+	r := NewReport()
+	r.AddFile("/tmp/config")
+	r.AddFile("/tmp/config")
+
+	var b bytes.Buffer
+	require.Nil(t, r.Write(&b))
+
+	m := map[string]interface{}{}
+	require.Nil(t, json.Unmarshal(b.Bytes(), &m))
+	require.Equal(t, []interface{}{"/tmp/config"}, m["files"])
+	require.Equal(t, []interface{}{}, m["profiles"])
+	require.Equal(t, []interface{}{}, m["failures"])
+	require.NotContains(t, m, "error")
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const diffContext = 3
+
+// Sandbox redirects the writes to temporary copies of the files,
+// so the changes can be reviewed without touching the original files
+type Sandbox struct {
+	Dir   string
+	files map[string]string
+	order []string
+}
+
+// NewSandbox returns a new Sandbox backed by a temporary directory
+func NewSandbox() (*Sandbox, error) {
+	dir, err := os.MkdirTemp("", "asl-dry-run")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Sandbox{
+		Dir:   dir,
+		files: map[string]string{},
+	}, nil
+}
+
+// Path returns the file to be written instead of the original one, the original content
+// is copied on the first call. A nil sandbox returns the original path.
+func (s *Sandbox) Path(path string) (string, error) {
+	if s == nil {
+		return path, nil
+	}
+
+	if p, ok := s.files[path]; ok {
+		return p, nil
+	}
+
+	p := filepath.Join(s.Dir, fmt.Sprintf("%d-%s", len(s.order), filepath.Base(path)))
+
+	src := NewFile(path)
+	if src.Exists() {
+		b, err := src.Read()
+		if err != nil {
+			return "", err
+		}
+
+		if err := os.WriteFile(p, b, filePerm); err != nil {
+			return "", err
+		}
+	}
+
+	s.files[path] = p
+	s.order = append(s.order, path)
+
+	return p, nil
+}
+
+// Diff writes a unified diff with the secrets redacted for each changed file
+func (s *Sandbox) Diff(w io.Writer) (int, error) {
+	var changed int
+	for _, path := range s.order {
+		before, err := readIfExists(path)
+		if err != nil {
+			return changed, err
+		}
+
+		after, err := readIfExists(s.files[path])
+		if err != nil {
+			return changed, err
+		}
+
+		if before == after {
+			continue
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(RedactText(before)),
+			B:        splitLines(RedactText(after)),
+			FromFile: "a" + path,
+			ToFile:   "b" + path,
+			Context:  diffContext,
+		})
+		if err != nil {
+			return changed, err
+		}
+
+		if _, err := io.WriteString(w, diff); err != nil {
+			return changed, err
+		}
+
+		changed++
+	}
+
+	return changed, nil
+}
+
+// Close removes the temporary copies
+func (s *Sandbox) Close() error {
+	if s == nil {
+		return nil
+	}
+
+	return os.RemoveAll(s.Dir)
+}
+
+func readIfExists(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	if len(b) == 0 {
+		return "", nil
+	}
+
+	return strings.TrimSuffix(string(b), "\n") + "\n", nil
+}
+
+// splitLines splits the text keeping the line breaks, the content must end with a line break
+func splitLines(text string) []string {
+	lines := strings.SplitAfter(text, "\n")
+	return lines[:len(lines)-1]
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandboxDiff(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "credentials")
+	_ = os.WriteFile(filename, []byte("[dev]\naws_access_key_id = foo\naws_secret_access_key = old\n"), 0600)
+
+	s, err := NewSandbox()
+	require.Nil(t, err)
+	defer s.Close()
+
+	p, err := s.Path(filename)
+	require.Nil(t, err)
+	require.NotEqual(t, filename, p)
+
+	same, _ := s.Path(filename)
+	require.Equal(t, p, same)
+
+	_ = NewFile(p).Write("[dev]\naws_access_key_id = bar\naws_secret_access_key = new\n")
+
+	untouched, _ := s.Path(filepath.Join(dir, "config"))
+	require.NoFileExists(t, untouched)
+
+	var out bytes.Buffer
+	changed, err := s.Diff(&out)
+	require.Nil(t, err)
+	require.Equal(t, 1, changed)
+	require.Equal(t, `--- a`+filename+`
++++ b`+filename+`
+@@ -1,3 +1,3 @@
+ [dev]
+-aws_access_key_id = foo
++aws_access_key_id = bar
+ aws_secret_access_key = ********
+`, out.String())
+
+	b, _ := os.ReadFile(filename)
+	require.Contains(t, string(b), "old")
+}
+
+func TestNilSandboxPath(t *testing.T) {
+	var s *Sandbox
+	p, err := s.Path("/tmp/foo")
+	require.Nil(t, err)
+	require.Equal(t, "/tmp/foo", p)
+}
+
+func TestRedactText(t *testing.T) {
+	text := "[dev]\naws_secret_access_key=foo\n  aws_session_token = bar\nregion = us-east-1\n    token: baz"
+	require.Equal(t, "[dev]\naws_secret_access_key=********\n  aws_session_token = ********\nregion = us-east-1\n    token: ********", RedactText(text))
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/go-homedir"
+	logger "github.com/rs/zerolog/log"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+	"golang.org/x/term"
+)
+
+const (
+	// SecretStoreFile keeps the secrets in plain files readable only by the user
+	SecretStoreFile = "file"
+	// SecretStoreSecretService keeps the secrets in the Linux Secret Service (gnome-keyring, kwallet) through secret-tool
+	SecretStoreSecretService = "secret-service"
+	// SecretStoreVault keeps the secrets in a file encrypted with a passphrase
+	SecretStoreVault = "vault"
+
+	secretService     = "asl"
+	vaultPassphrase   = "ASL_VAULT_PASSPHRASE"
+	vaultVersion      = 1
+	vaultKeySize      = 32
+	vaultNonceSize    = 24
+	vaultSaltSize     = 16
+	vaultScryptN      = 1 << 15
+	vaultScryptR      = 8
+	vaultScryptP      = 1
+	secretTokenPrefix = "sso-token/"
+	secretCredPrefix  = "credentials/"
+)
+
+var secretsPath string
+
+// SecretStore keeps the sso access token and the role credentials out of the aws files,
+// Get returns an error that wraps os.ErrNotExist when the key does not exist
+type SecretStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, value []byte) error
+	Delete(key string) error
+}
+
+// NewSecretStore returns the secret store chosen in the asl config, it is nil when
+// the secrets are kept in the aws files
+func NewSecretStore(c *ConfigOptions) (SecretStore, error) {
+	switch c.SecretStore {
+	case "":
+		return nil, nil
+	case SecretStoreFile:
+		return &FileStore{Dir: filepath.Join(secretsPath, "secrets")}, nil
+	case SecretStoreSecretService:
+		return &SecretServiceStore{}, nil
+	case SecretStoreVault:
+		vault := NewFile(secretsPath, "vault")
+		vault.Secret = true
+		return &VaultStore{File: vault, Passphrase: readVaultPassphrase}, nil
+	default:
+		return nil, fmt.Errorf("invalid secret store %q, use [%s|%s|%s]", c.SecretStore, SecretStoreFile, SecretStoreSecretService, SecretStoreVault)
+	}
+}
+
+// ----- file -----
+
+// FileStore keeps each secret in a file readable only by the user
+type FileStore struct {
+	Dir string
+}
+
+// Get reads a secret
+func (s *FileStore) Get(key string) ([]byte, error) {
+	return s.file(key).Read()
+}
+
+// Set writes a secret
+func (s *FileStore) Set(key string, value []byte) error {
+	f := s.file(key)
+	if err := f.Create(); err != nil {
+		return err
+	}
+	return f.WriteAtomic(value)
+}
+
+// Delete removes a secret
+func (s *FileStore) Delete(key string) error {
+	if err := os.Remove(s.file(key).FullName); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// file returns the file of a key, the key is encoded so that a profile name
+// can neither leave the store directory nor collide with another key
+func (s *FileStore) file(key string) *File {
+	f := NewFile(s.Dir, base64.RawURLEncoding.EncodeToString([]byte(key)))
+	f.Secret = true
+	return f
+}
+
+// ----- secret service -----
+
+// SecretServiceStore keeps the secrets in the Linux Secret Service using the secret-tool command (libsecret)
+type SecretServiceStore struct{}
+
+// Get reads a secret
+func (s *SecretServiceStore) Get(key string) ([]byte, error) {
+	out, err := s.exec(nil, "lookup", "service", secretService, "key", key)
+	if err != nil {
+		return nil, err
+	}
+
+	// secret-tool exits with an empty output when the secret does not exist
+	if len(out) == 0 {
+		return nil, fmt.Errorf("secret %s: %w", key, os.ErrNotExist)
+	}
+
+	return out, nil
+}
+
+// Set writes a secret, it is read by secret-tool from stdin
+func (s *SecretServiceStore) Set(key string, value []byte) error {
+	_, err := s.exec(value, "store", "--label", "asl "+key, "service", secretService, "key", key)
+	return err
+}
+
+// Delete removes a secret
+func (s *SecretServiceStore) Delete(key string) error {
+	_, err := s.exec(nil, "clear", "service", secretService, "key", key)
+	return err
+}
+
+func (s *SecretServiceStore) exec(input []byte, args ...string) ([]byte, error) {
+	cmd := execCommand("secret-tool", args...)
+	if input != nil {
+		cmd.Stdin = bytes.NewReader(input)
+	}
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		if len(out) == 0 && stderr.Len() == 0 && args[0] == "lookup" {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("[secret-tool] %s: %w", strings.TrimSpace(stderr.String()), err)
+	}
+
+	return bytes.TrimSuffix(out, []byte("\n")), nil
+}
+
+// ----- vault -----
+
+// VaultStore keeps the secrets in a single file encrypted with a key derived from a passphrase (scrypt and NaCl secretbox)
+type VaultStore struct {
+	File       *File
+	Passphrase func() ([]byte, error)
+
+	key  []byte
+	salt []byte
+}
+
+type vaultFile struct {
+	Version int    `json:"version"`
+	Salt    []byte `json:"salt"`
+	Nonce   []byte `json:"nonce"`
+	Data    []byte `json:"data"`
+}
+
+// Get reads a secret
+func (s *VaultStore) Get(key string) ([]byte, error) {
+	if !s.File.Exists() {
+		return nil, fmt.Errorf("secret %s: %w", key, os.ErrNotExist)
+	}
+
+	b, err := s.File.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	secrets, err := s.open(b)
+	if err != nil {
+		return nil, err
+	}
+
+	v, ok := secrets[key]
+	if !ok {
+		return nil, fmt.Errorf("secret %s: %w", key, os.ErrNotExist)
+	}
+
+	return v, nil
+}
+
+// Set writes a secret
+func (s *VaultStore) Set(key string, value []byte) error {
+	return s.update(func(secrets map[string][]byte) {
+		secrets[key] = value
+	})
+}
+
+// Delete removes a secret
+func (s *VaultStore) Delete(key string) error {
+	return s.update(func(secrets map[string][]byte) {
+		delete(secrets, key)
+	})
+}
+
+func (s *VaultStore) update(fn func(map[string][]byte)) error {
+	if err := s.File.Create(); err != nil {
+		return err
+	}
+
+	return s.File.Update(func(b []byte) ([]byte, error) {
+		secrets, err := s.open(b)
+		if err != nil {
+			return nil, err
+		}
+
+		fn(secrets)
+
+		return s.seal(secrets)
+	})
+}
+
+// open decrypts the vault content, an empty vault is created when there is no content
+func (s *VaultStore) open(b []byte) (map[string][]byte, error) {
+	secrets := map[string][]byte{}
+	if len(bytes.TrimSpace(b)) == 0 {
+		return secrets, nil
+	}
+
+	v := &vaultFile{}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, fmt.Errorf("the vault %s is malformed: %w", s.File.FullName, err)
+	}
+
+	if v.Version > vaultVersion {
+		return nil, fmt.Errorf("the vault version %d is not supported, please upgrade asl", v.Version)
+	}
+
+	if len(v.Nonce) != vaultNonceSize {
+		return nil, fmt.Errorf("the vault %s is malformed: invalid nonce", s.File.FullName)
+	}
+
+	key, err := s.derive(v.Salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [vaultNonceSize]byte
+	copy(nonce[:], v.Nonce)
+
+	data, ok := secretbox.Open(nil, v.Data, &nonce, key)
+	if !ok {
+		s.key = nil
+		return nil, errors.New("the vault can not be decrypted, the passphrase is wrong")
+	}
+
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, err
+	}
+
+	return secrets, nil
+}
+
+// seal encrypts the secrets with a new nonce
+func (s *VaultStore) seal(secrets map[string][]byte) ([]byte, error) {
+	if s.salt == nil {
+		s.salt = make([]byte, vaultSaltSize)
+		if _, err := rand.Read(s.salt); err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := s.derive(s.salt)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [vaultNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(secrets)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.MarshalIndent(&vaultFile{
+		Version: vaultVersion,
+		Salt:    s.salt,
+		Nonce:   nonce[:],
+		Data:    secretbox.Seal(nil, data, &nonce, key),
+	}, "", " ")
+}
+
+// derive returns the key derived from the passphrase, the passphrase is asked once
+func (s *VaultStore) derive(salt []byte) (*[vaultKeySize]byte, error) {
+	if s.key == nil || !bytes.Equal(s.salt, salt) {
+		passphrase, err := s.Passphrase()
+		if err != nil {
+			return nil, err
+		}
+
+		if len(passphrase) == 0 {
+			return nil, errors.New("the vault passphrase must not be empty")
+		}
+
+		s.key, err = scrypt.Key(passphrase, salt, vaultScryptN, vaultScryptR, vaultScryptP, vaultKeySize)
+		if err != nil {
+			return nil, err
+		}
+		s.salt = salt
+	}
+
+	var key [vaultKeySize]byte
+	copy(key[:], s.key)
+	return &key, nil
+}
+
+// readVaultPassphrase reads the passphrase from ASL_VAULT_PASSPHRASE or asks for it in the terminal
+func readVaultPassphrase() ([]byte, error) {
+	if v, ok := os.LookupEnv(vaultPassphrase); ok {
+		return []byte(v), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return nil, fmt.Errorf("the vault passphrase can not be asked, please set %s", vaultPassphrase)
+	}
+
+	fmt.Fprint(os.Stderr, "asl vault passphrase: ")
+	b, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+
+	return b, err
+}
+
+func init() {
+	home, err := homedir.Dir()
+	if err != nil {
+		logger.Fatal().Err(err)
+	}
+
+	data := os.Getenv("XDG_DATA_HOME")
+	if data == "" {
+		data = filepath.Join(home, ".local", "share")
+	}
+
+	secretsPath = filepath.Join(data, "asl")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVaultStore(t *testing.T) {
+	asked := 0
+	passphrase := "correct horse"
+	vault := &VaultStore{
+		File: NewFile(t.TempDir(), "vault"),
+		Passphrase: func() ([]byte, error) {
+			asked++
+			return []byte(passphrase), nil
+		},
+	}
+
+	_, err := vault.Get("credentials/dev")
+	require.True(t, errors.Is(err, os.ErrNotExist))
+
+	require.Nil(t, vault.Set("credentials/dev", []byte("secret-value")))
+	require.Nil(t, vault.Set("credentials/prod", []byte("other-value")))
+	require.Nil(t, vault.Delete("credentials/prod"))
+
+	v, err := vault.Get("credentials/dev")
+	require.Nil(t, err)
+	require.Equal(t, "secret-value", string(v))
+	require.Equal(t, 1, asked)
+
+	_, err = vault.Get("credentials/prod")
+	require.True(t, errors.Is(err, os.ErrNotExist))
+
+	b, _ := vault.File.Read()
+	require.NotContains(t, string(b), "secret-value")
+
+	fi, _ := os.Stat(vault.File.FullName)
+	require.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	passphrase = "wrong"
+	other := &VaultStore{File: vault.File, Passphrase: vault.Passphrase}
+	_, err = other.Get("credentials/dev")
+	require.EqualError(t, err, "the vault can not be decrypted, the passphrase is wrong")
+}
+
+func TestSecretServiceStore(t *testing.T) {
+	var cmdline []string
+	execCommand = func(name string, args ...string) *exec.Cmd {
+		cmdline = append([]string{name}, args...)
+		return exec.Command("sh", "-c", "cat")
+	}
+	t.Cleanup(func() { execCommand = exec.Command })
+
+	s := &SecretServiceStore{}
+	require.Nil(t, s.Set("credentials/dev", []byte("secret-value")))
+	require.Equal(t, "secret-tool store --label asl credentials/dev service asl key credentials/dev", strings.Join(cmdline, " "))
+
+	_, err := s.Get("credentials/dev")
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestFileStoreKeys(t *testing.T) {
+	dir := t.TempDir()
+	s := &FileStore{Dir: filepath.Join(dir, "secrets")}
+
+	require.Nil(t, s.Set("credentials/../../escape", []byte("foo")))
+	require.Nil(t, s.Set("credentials/a/b", []byte("bar")))
+	require.Nil(t, s.Set("credentials/a_b", []byte("baz")))
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+
+	entries, err = os.ReadDir(s.Dir)
+	require.Nil(t, err)
+	require.Len(t, entries, 3)
+
+	b, err := s.Get("credentials/../../escape")
+	require.Nil(t, err)
+	require.Equal(t, "foo", string(b))
+
+	b, err = s.Get("credentials/a/b")
+	require.Nil(t, err)
+	require.Equal(t, "bar", string(b))
+
+	require.Nil(t, s.Delete("credentials/a/b"))
+	_, err = s.Get("credentials/a/b")
+	require.True(t, errors.Is(err, os.ErrNotExist))
+}
+
+func TestPersistCredentialsSecretStore(t *testing.T) {
+	dir := withAWSPath(t)
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{SecretStore: SecretStoreFile})
+	sso.Secrets = &FileStore{Dir: filepath.Join(dir, "secrets")}
+
+	expiration := time.Now().Add(time.Hour).Truncate(time.Second)
+	_, err := sso.PersistCredentials([]*Credential{{
+		ProfileName:     "dev",
+		Region:          "us-east-1",
+		AccessKeyID:     "ASIAEXAMPLE",
+		SecretAccessKey: "secret-key",
+		SessionToken:    "secret-session",
+		Expiration:      expiration.Unix() * 1000,
+	}})
+	require.Nil(t, err)
+
+	b, _ := os.ReadFile(filepath.Join(dir, "credentials"))
+	require.NotContains(t, string(b), "secret-key")
+	require.NotContains(t, string(b), "secret-session")
+	require.Contains(t, string(b), "credential_process = ")
+	require.Contains(t, string(b), " credential-process --secret-store file --profile dev\n")
+
+	out, err := ReadCredentialProcess(sso.Secrets, "dev")
+	require.Nil(t, err)
+	require.JSONEq(t, `{"Version": 1, "AccessKeyId": "ASIAEXAMPLE", "SecretAccessKey": "secret-key", "SessionToken": "secret-session",
+		"Expiration": "`+expiration.UTC().Format(time.RFC3339)+`"}`, string(out))
+
+	_, err = ReadCredentialProcess(sso.Secrets, "prod")
+	require.EqualError(t, err, "no credentials have been found for the profile prod, please run: asl")
+}
+
+func TestReadCacheFileSecretStore(t *testing.T) {
+	dir := withAWSPath(t)
+
+	startURL := "https://foo.awsapps.com/start"
+	hash := sha1.Sum([]byte(startURL))
+	cache := filepath.Join(dir, awsSSOPath, "cache", hex.EncodeToString(hash[:])+".json")
+	_ = os.MkdirAll(filepath.Dir(cache), 0750)
+	_ = os.WriteFile(cache, []byte(`{"startUrl": "`+startURL+`", "accessToken": "secret-token", "expiresAt": "2030-01-01T00:00:00Z"}`), 0600)
+
+	sso := NewSSO(&SSOMock{}, &ConfigOptions{StartURL: startURL})
+	sso.Secrets = &FileStore{Dir: filepath.Join(dir, "secrets")}
+
+	c, err := sso.ReadCacheFile()
+	require.Nil(t, err)
+	require.Equal(t, "secret-token", c.AccessToken)
+	require.NoFileExists(t, cache)
+
+	c, err = sso.ReadCacheFile()
+	require.Nil(t, err)
+	require.Equal(t, "secret-token", c.AccessToken)
+}
@@ -1,6 +1,9 @@
 package main
 
-import "regexp"
+import (
+	"path/filepath"
+	"regexp"
+)
 
 var (
 	matchFirstCap = regexp.MustCompile("(.)([A-Z][a-z]+)")
@@ -12,3 +15,13 @@ func Snake(txt string) string {
 	snake := matchFirstCap.ReplaceAllString(txt, "${1}-${2}")
 	return matchAllCap.ReplaceAllString(snake, "${1}-${2}")
 }
+
+// MatchAny returns if the value matches any of the shell patterns
+func MatchAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if ok, _ := filepath.Match(p, value); ok {
+			return true
+		}
+	}
+	return false
+}
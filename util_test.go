@@ -15,3 +15,9 @@ func TestRoleNameSnake(t *testing.T) {
 	r := Snake("DevSSOLogin")
 	require.Equal(t, "Dev-SSO-Login", r)
 }
+
+func TestMatchAny(t *testing.T) {
+	require.False(t, MatchAny(nil, "foo"))
+	require.True(t, MatchAny([]string{"bar", "fo*"}, "foo"))
+	require.False(t, MatchAny([]string{"bar", "fo"}, "foo"))
+}